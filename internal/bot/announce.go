@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// Announcer posts now playing messages in the text channel a guilds session was started from
+type Announcer struct {
+	musicBot *MusicBot
+
+	mu sync.Mutex
+	// text channel of each guilds session
+	channels map[snowflake.ID]snowflake.ID
+	// last now playing message of each guild, edited on the next track start
+	messages map[snowflake.ID]snowflake.ID
+}
+
+func newAnnouncer(musicBot *MusicBot) *Announcer {
+	return &Announcer{
+		musicBot: musicBot,
+		channels: make(map[snowflake.ID]snowflake.ID),
+		messages: make(map[snowflake.ID]snowflake.ID),
+	}
+}
+
+// remembers the text channel of the guilds session, if it doesn't have one yet
+func (a *Announcer) SetChannel(guildID snowflake.ID, channelID snowflake.ID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.channels[guildID]; !ok {
+		a.channels[guildID] = channelID
+	}
+}
+
+// returns the announce channel from the guild settings, or the text channel of the guilds session
+func (a *Announcer) Channel(guildID snowflake.ID) (snowflake.ID, bool) {
+	if channelID := a.musicBot.Settings.Get(guildID).AnnounceChannelID; channelID != 0 {
+		return channelID, true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	channelID, ok := a.channels[guildID]
+	return channelID, ok
+}
+
+func (a *Announcer) SetEnabled(guildID snowflake.ID, enabled bool) error {
+	return a.musicBot.Settings.Update(guildID, func(settings *GuildSettings) {
+		settings.AnnounceDisabled = !enabled
+	})
+}
+
+func (a *Announcer) Enabled(guildID snowflake.ID) bool {
+	return !a.musicBot.Settings.Get(guildID).AnnounceDisabled
+}
+
+// forgets the session of the guild, called when the bot leaves the voice channel
+func (a *Announcer) EndSession(guildID snowflake.ID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.channels, guildID)
+	delete(a.messages, guildID)
+}
+
+// posts the now playing message for the track, or edits the previous one
+func (a *Announcer) Announce(guildID snowflake.ID, track lavalink.Track) {
+	if !a.Enabled(guildID) {
+		return
+	}
+	channelID, ok := a.Channel(guildID)
+	if !ok {
+		return
+	}
+
+	embed, components := a.musicBot.nowPlayingPanel(guildID, &track)
+	rest := a.musicBot.Client.Rest()
+
+	a.mu.Lock()
+	messageID, hasMessage := a.messages[guildID]
+	a.mu.Unlock()
+
+	if hasMessage && k.Bool("announce.edit") {
+		_, err := rest.UpdateMessage(channelID, messageID, panelMessage(embed, components))
+		if err == nil {
+			return
+		}
+		// the message was probably deleted, post a new one
+		logger.Debug("could not edit now playing message", tint.Err(err))
+	}
+
+	message, err := rest.CreateMessage(channelID, discord.MessageCreate{
+		Embeds:     []discord.Embed{embed},
+		Components: components,
+	})
+	if err != nil {
+		msg := "error while posting now playing message"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		return
+	}
+
+	a.mu.Lock()
+	a.messages[guildID] = message.ID
+	a.mu.Unlock()
+}
+
+// posts a message in the text channel of the guilds session
+func (a *Announcer) Notify(guildID snowflake.ID, content string) {
+	channelID, ok := a.Channel(guildID)
+	if !ok {
+		return
+	}
+
+	if _, err := a.musicBot.Client.Rest().CreateMessage(channelID, discord.MessageCreate{
+		Content:         content,
+		AllowedMentions: &discord.AllowedMentions{},
+	}); err != nil {
+		msg := "error while posting notification"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+	}
+}
+
+// redraws the last now playing message of the guild with the current player state
+func (a *Announcer) Refresh(guildID snowflake.ID) {
+	channelID, ok := a.Channel(guildID)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	messageID, hasMessage := a.messages[guildID]
+	a.mu.Unlock()
+	if !hasMessage {
+		return
+	}
+
+	embed, components := a.musicBot.nowPlayingPanel(guildID, nil)
+	if _, err := a.musicBot.Client.Rest().UpdateMessage(channelID, messageID, panelMessage(embed, components)); err != nil {
+		logger.Debug("could not refresh now playing message", tint.Err(err))
+	}
+}
+
+func (h CmdHandler) announce(event *handler.CommandEvent) error {
+	logger.Info("Received /announce command")
+
+	enabled := event.SlashCommandInteractionData().Bool("enabled")
+	if err := h.musicBot.Announcer.SetEnabled(*event.GuildID(), enabled); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while saving announcement setting: `%s`", err),
+		})
+	}
+
+	status := "disabled"
+	if enabled {
+		status = "enabled"
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Now playing announcements %s", status),
+	})
+}
@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// amount of related tracks queued at once
+const autoplayBatch = 3
+
+// Autoplay keeps playing related tracks when the queue of a guild runs out
+type Autoplay struct {
+	musicBot *MusicBot
+
+	mu sync.Mutex
+	// guilds autoplay is currently looking for tracks in
+	filling map[snowflake.ID]*autoplayFill
+}
+
+// a running Fill, other callers wait for it instead of looking for tracks again
+type autoplayFill struct {
+	// closed once the fill finished
+	done   chan struct{}
+	queued bool
+}
+
+func newAutoplay(musicBot *MusicBot) *Autoplay {
+	return &Autoplay{
+		musicBot: musicBot,
+		filling:  make(map[snowflake.ID]*autoplayFill),
+	}
+}
+
+func (a *Autoplay) SetEnabled(guildID snowflake.ID, enabled bool) error {
+	return a.musicBot.Settings.Update(guildID, func(settings *GuildSettings) {
+		settings.Autoplay = enabled
+	})
+}
+
+func (a *Autoplay) Enabled(guildID snowflake.ID) bool {
+	return a.musicBot.Settings.Get(guildID).Autoplay
+}
+
+// queues tracks related to the seed track if autoplay is enabled and the queue is empty.
+// if the guild is filled already, waits for that fill instead.
+// reports whether tracks were queued.
+func (a *Autoplay) Fill(guildID snowflake.ID, seed lavalink.Track) bool {
+	queue := a.musicBot.Queues.Get(guildID)
+	if !a.Enabled(guildID) || queue.Type() != QueueTypeNormal {
+		return false
+	}
+
+	a.mu.Lock()
+	if running, ok := a.filling[guildID]; ok {
+		a.mu.Unlock()
+		<-running.done
+		return running.queued
+	}
+	if queue.Len() > 0 {
+		a.mu.Unlock()
+		return false
+	}
+	fill := &autoplayFill{done: make(chan struct{})}
+	a.filling[guildID] = fill
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		delete(a.filling, guildID)
+		a.mu.Unlock()
+		close(fill.done)
+	}()
+
+	fill.queued = a.fill(guildID, seed)
+	return fill.queued
+}
+
+// looks for tracks related to the seed and queues them, reports whether tracks were queued
+func (a *Autoplay) fill(guildID snowflake.ID, seed lavalink.Track) bool {
+	queue := a.musicBot.Queues.Get(guildID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tracks, err := a.related(ctx, guildID, seed)
+	if err != nil {
+		msg := "error while looking for related tracks"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		return false
+	}
+
+	tracks, _ = a.musicBot.limitTracks(guildID, withRequest(tracks, TrackRequest{
+		Autoplay:    true,
+		RequestedAt: time.Now(),
+	}))
+	if len(tracks) == 0 {
+		logger.Info("autoplay found no related tracks", slog.String("guild.id", guildID.String()), slog.String("seed", seed.Info.Title))
+		return false
+	}
+
+	queue.Add(tracks...)
+	logger.Info("autoplay queued related tracks", slog.String("guild.id", guildID.String()), slog.String("seed", seed.Info.Title), slog.Int("count", len(tracks)))
+	return true
+}
+
+// returns tracks related to the seed track which weren't played recently.
+// the youtube mix of the seed is used, tracks from other sources are looked up on youtube first.
+// if there is no mix, other tracks of the same author are used.
+func (a *Autoplay) related(ctx context.Context, guildID snowflake.ID, seed lavalink.Track) ([]lavalink.Track, error) {
+	videoID := ""
+	if seed.Info.SourceName == "youtube" {
+		videoID = seed.Info.Identifier
+	} else if results, err := a.musicBot.loadTracks(ctx, guildID, lavalink.SearchTypeYouTube.Apply(seed.Info.Author+" "+seed.Info.Title)); err == nil && len(results) > 0 {
+		videoID = results[0].Info.Identifier
+	}
+
+	var candidates []lavalink.Track
+	if videoID != "" {
+		mix, err := a.musicBot.loadTracks(ctx, guildID, fmt.Sprintf("https://www.youtube.com/watch?v=%s&list=RD%s", videoID, videoID))
+		if err != nil {
+			logger.Debug("could not load youtube mix", tint.Err(err))
+		}
+		candidates = append(candidates, mix...)
+	}
+
+	if len(candidates) <= 1 {
+		// loadTracks only keeps the first search result, so search for other tracks of the author directly
+		byAuthor, err := a.musicBot.BestNode(guildID).LoadTracks(ctx, lavalink.SearchTypeYouTube.Apply(seed.Info.Author))
+		if err != nil {
+			return nil, eris.Wrap(err, "error while searching tracks of the author")
+		}
+		if results, ok := byAuthor.Data.(lavalink.Search); ok {
+			candidates = append(candidates, results...)
+		}
+	}
+
+	var tracks []lavalink.Track
+	for _, track := range candidates {
+		if len(tracks) >= autoplayBatch {
+			break
+		}
+		if track.Info.IsStream || trackKey(track) == trackKey(seed) || a.musicBot.History.Contains(guildID, track) {
+			continue
+		}
+		if slices.ContainsFunc(tracks, func(t lavalink.Track) bool { return trackKey(t) == trackKey(track) }) {
+			continue
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// looks for tracks related to the seed in the background and plays the first of them, used once the queue ran out.
+// the lookup takes several lavalink requests, which mustn't block the lavalink event listeners.
+func (a *Autoplay) PlayRelated(player disgolink.Player, seed lavalink.Track) {
+	guildID := player.GuildID()
+	if !a.Enabled(guildID) {
+		return
+	}
+
+	go func() {
+		if !a.Fill(guildID, seed) {
+			return
+		}
+		// something else may have been played while looking for tracks
+		if player.Track() != nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		nextTrack, ok, err := a.musicBot.Queues.Get(guildID).NextAndPlay(func(track lavalink.Track) error {
+			return player.Update(ctx, lavalink.WithTrack(track))
+		})
+		if !ok {
+			return
+		}
+		if err != nil {
+			msg := "error while playing related track"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+			return
+		}
+		logger.Info("Playing related track", slog.String("guild.id", guildID.String()), slog.String("title", nextTrack.Info.Title))
+	}()
+}
+
+// continues with related tracks after the last track of the queue was skipped.
+// the tracks are looked up in the background, as that can take longer than an interaction may.
+// reports whether autoplay is enabled, if not the caller has to stop the player itself.
+func (a *Autoplay) SkipToRelated(player disgolink.Player) bool {
+	guildID := player.GuildID()
+	seed := player.Track()
+	if seed == nil || !a.Enabled(guildID) || a.musicBot.Queues.Get(guildID).Type() != QueueTypeNormal {
+		return false
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		play := func(track lavalink.Track) error {
+			return player.Update(ctx, lavalink.WithTrack(track))
+		}
+		_, ok, err := a.musicBot.Queues.Get(guildID).NextAndPlay(play)
+		if !ok && a.Fill(guildID, *seed) {
+			_, ok, err = a.musicBot.Queues.Get(guildID).NextAndPlay(play)
+		}
+		if !ok {
+			err = player.Update(ctx, lavalink.WithNullTrack())
+		}
+		if err != nil {
+			msg := "error while skipping to related track"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		}
+	}()
+	return true
+}
+
+func (h CmdHandler) autoplay(event *handler.CommandEvent) error {
+	logger.Info("Received /autoplay command")
+
+	enabled := event.SlashCommandInteractionData().Bool("enabled")
+	if err := h.musicBot.Autoplay.SetEnabled(*event.GuildID(), enabled); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while saving autoplay setting: `%s`", err),
+		})
+	}
+
+	// if nothing is playing anymore, continue with tracks related to the last one.
+	// otherwise related tracks are queued once the queue runs out.
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if entries := h.musicBot.History.Entries(*event.GuildID()); enabled && player != nil && player.Track() == nil && len(entries) > 0 {
+		h.musicBot.Autoplay.PlayRelated(player, entries[0].Track)
+	}
+
+	status := "disabled"
+	if enabled {
+		status = "enabled, related tracks are played when the queue runs out"
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Autoplay %s", status),
+	})
+}
@@ -2,8 +2,11 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/disgoorg/disgo"
@@ -14,6 +17,7 @@ import (
 	"github.com/disgoorg/disgolink/v3/disgolink"
 	"github.com/disgoorg/disgolink/v3/lavalink"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
 	"github.com/rotisserie/eris"
 )
 
@@ -27,23 +31,95 @@ type MusicBot struct {
 	// Music queue manager
 	Queues *QueueManager
 
+	// Lavalink node health tracking and failover
+	Nodes *NodePool
+
+	// Persistent queue storage
+	Store QueueStore
+
+	// Now playing announcements
+	Announcer *Announcer
+
+	// Active audio filters
+	Filters *FilterManager
+
+	// Leaves voice channels when idle or alone
+	Idle *IdleManager
+
+	// DJ roles and command permissions
+	Permissions *Permissions
+
+	// Skip votes of the current tracks
+	VoteSkips *VoteSkips
+
+	// Plays related tracks when the queue runs out
+	Autoplay *Autoplay
+
+	// Recently played tracks
+	History *History
+
+	// Retries and skips tracks which fail to play
+	Recovery *Recovery
+
+	// Reconnects closed voice connections
+	Voice *VoiceRecovery
+
+	// Per guild settings
+	Settings *SettingsManager
+
+	// Saved playlists of users and guilds
+	Playlists PlaylistStore
+
 	lavalinkNodes map[string]disgolink.Node
+
+	// search results waiting to be picked by a user
+	searchPicks *searchPicks
+
+	// recent /play uses of every user
+	playLimits *rateLimiter
+
+	// closed when the bot is shutting down
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func NewMusicBot(token string) (*MusicBot, error) {
+// creates the bot, opts are applied after the defaults, e.g. to replace the gateway
+func NewMusicBot(token string, opts ...bot.ConfigOpt) (*MusicBot, error) {
 	// create wrapper for the bot
 	musicBot := &MusicBot{
 
 		// Create a new queue manager
-		Queues: &QueueManager{
-			// initialize the map of queues
-			queues: make(map[snowflake.ID]*Queue),
-		},
+		Queues: NewQueueManager(),
+
+		Filters: NewFilterManager(),
+
+		VoteSkips: NewVoteSkips(),
+
+		History: NewHistory(),
+
+		Store: NewFileQueueStore(filepath.Join(k.String("storage.path"), "queues")),
+
+		Settings: NewSettingsManager(NewFileSettingsStore(filepath.Join(k.String("storage.path"), "settings"))),
+
+		Playlists: NewFilePlaylistStore(filepath.Join(k.String("storage.path"), "playlists")),
 
 		lavalinkNodes: make(map[string]disgolink.Node),
-	}
 
-	client, err := disgo.New(token,
+		searchPicks: newSearchPicks(),
+
+		playLimits: newRateLimiter(),
+
+		done: make(chan struct{}),
+	}
+	musicBot.Nodes = newNodePool(musicBot)
+	musicBot.Announcer = newAnnouncer(musicBot)
+	musicBot.Idle = newIdleManager(musicBot)
+	musicBot.Permissions = newPermissions(musicBot)
+	musicBot.Autoplay = newAutoplay(musicBot)
+	musicBot.Recovery = newRecovery(musicBot)
+	musicBot.Voice = newVoiceRecovery(musicBot)
+
+	client, err := disgo.New(token, append([]bot.ConfigOpt{
 		bot.WithGatewayConfigOpts(
 			// auto reconnect on disconnect
 			gateway.WithAutoReconnect(true),
@@ -72,7 +148,7 @@ func NewMusicBot(token string) (*MusicBot, error) {
 		bot.WithEventListenerFunc(musicBot.onVoiceServerUpdate),
 		// Register the logger
 		bot.WithLogger(logger),
-	)
+	}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +162,7 @@ func NewMusicBot(token string) (*MusicBot, error) {
 		disgolink.WithListenerFunc(musicBot.onTrackException),
 		disgolink.WithListenerFunc(musicBot.onTrackStuck),
 		disgolink.WithListenerFunc(musicBot.onWebSocketClosed),
+		disgolink.WithPlugins(musicBot.Nodes),
 	)
 	musicBot.Lavalink = llclient
 
@@ -94,77 +171,205 @@ func NewMusicBot(token string) (*MusicBot, error) {
 
 func (b *MusicBot) onPlayerPause(player disgolink.Player, event lavalink.PlayerPauseEvent) {
 	logger.Debug("lavalink player paused", slog.Any("event", event))
+	b.Announcer.Refresh(event.GuildID())
 }
 
 func (b *MusicBot) onPlayerResume(player disgolink.Player, event lavalink.PlayerResumeEvent) {
 	logger.Debug("lavalink player resumed", slog.Any("event", event))
+	b.Announcer.Refresh(event.GuildID())
 }
 
 func (b *MusicBot) onTrackStart(player disgolink.Player, event lavalink.TrackStartEvent) {
 	logger.Debug("lavalink track started", slog.Any("event", event))
+
+	if request, ok := trackRequest(event.Track); ok {
+		logger.Info("Playing requested track", slog.String("title", event.Track.Info.Title), slog.String("requester", request.UserID.String()))
+	}
+
+	b.Idle.StopIdle(event.GuildID())
+	b.VoteSkips.Reset(event.GuildID())
+	b.Announcer.Announce(event.GuildID(), event.Track)
+	b.History.Add(event.GuildID(), event.Track)
 }
 
 func (b *MusicBot) onTrackEnd(player disgolink.Player, event lavalink.TrackEndEvent) {
 	logger.Info("lavalink track ended", slog.Any("event", event))
+
 	if !event.Reason.MayStartNext() {
+		// start the idle timer if nothing is playing afterwards
+		b.Idle.CheckPlaying(player)
+		return
+	}
+
+	if event.Reason == lavalink.TrackEndReasonLoadFailed {
+		// retry the track once before moving on
+		b.Recovery.Recover(player, b.Recovery.takeFailure(event.GuildID(), event.Track), func() {
+			b.playNext(player, event)
+		})
 		return
 	}
 
+	b.Recovery.Reset(event.GuildID())
+	b.playNext(player, event)
+}
+
+// plays the track following the ended one depending on the queue type
+func (b *MusicBot) playNext(player disgolink.Player, event lavalink.TrackEndEvent) {
+	// start the idle timer if nothing is playing afterwards
+	defer b.Idle.CheckPlaying(player)
+
+	failed := event.Reason == lavalink.TrackEndReasonLoadFailed
 	queue := b.Queues.Get(event.GuildID())
+	play := func(track lavalink.Track) error {
+		return player.Update(context.TODO(), lavalink.WithTrack(track))
+	}
+
 	var (
 		nextTrack lavalink.Track
 		ok        bool
+		err       error
 	)
-	switch queue.Type {
+	switch queue.Type() {
 	case QueueTypeNormal:
-		nextTrack, ok = queue.Next()
+		nextTrack, ok, err = queue.NextAndPlay(play)
+		// the queue ran out, continue with related tracks
+		if !ok {
+			b.Autoplay.PlayRelated(player, event.Track)
+		}
 
 	case QueueTypeRepeatTrack:
-		nextTrack = *player.Track()
+		// a track which keeps failing would repeat forever
+		if failed {
+			nextTrack, ok, err = queue.NextAndPlay(play)
+			break
+		}
+		// the player already cleared its track, but the event still carries the one that ended
+		nextTrack, ok = event.Track, true
+		err = play(nextTrack)
 
 	case QueueTypeRepeatQueue:
-		lastTrack, _ := b.Lavalink.BestNode().DecodeTrack(context.TODO(), event.Track.Encoded)
-		queue.Add(*lastTrack)
-		nextTrack, ok = queue.Next()
+		// put the ended track back at the end of the queue, unless it failed
+		if !failed {
+			queue.Add(event.Track)
+		}
+		nextTrack, ok, err = queue.NextAndPlay(play)
 	}
 
 	if !ok {
 		return
 	}
-	if err := player.Update(context.TODO(), lavalink.WithTrack(nextTrack)); err != nil {
-		logger.Error("Failed to play next track in queue", eris.Wrap(err, "failed to play next track in queue"))
+	if err != nil {
+		logger.Error("Failed to play next track in queue", tint.Err(eris.Wrap(err, "failed to play next track in queue")))
+		return
 	}
-	logger.Info("Playing next track in queue", slog.String("title", nextTrack.Info.Title), slog.String("uri", *nextTrack.Info.URI))
+	logger.Info("Playing next track in queue", slog.String("title", nextTrack.Info.Title), slog.String("uri", trackURI(nextTrack)))
 }
 
 func (b *MusicBot) onTrackException(player disgolink.Player, event lavalink.TrackExceptionEvent) {
 	logger.Error("lavalink track exception", slog.Any("event", event))
+
+	// lavalink ends the track right after, the failure is handled then
+	b.Recovery.Failed(event.GuildID(), trackFailure{
+		track:    event.Track,
+		reason:   event.Exception.Message,
+		severity: event.Exception.Severity,
+		position: player.Position(),
+	})
 }
 
 func (b *MusicBot) onTrackStuck(player disgolink.Player, event lavalink.TrackStuckEvent) {
 	logger.Error("lavalink track stuck", slog.Any("event", event))
+
+	// stuck tracks aren't ended by lavalink, so retry or skip them right away
+	failure := trackFailure{
+		track:    event.Track,
+		reason:   fmt.Sprintf("no audio for %s", formatPosition(event.Threshold)),
+		severity: lavalink.SeveritySuspicious,
+		position: player.Position(),
+	}
+	b.Recovery.Recover(player, failure, func() {
+		if err := b.skipCurrent(context.TODO(), player); err != nil {
+			msg := "error while skipping stuck track"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", event.GuildID().String()))
+		}
+	})
 }
 
 func (b *MusicBot) onWebSocketClosed(player disgolink.Player, event lavalink.WebSocketClosedEvent) {
-	logger.Info("lavalink websocket closed", slog.Any("event", event))
+	logger.Debug("lavalink websocket closed", slog.Any("event", event))
+
+	b.Voice.OnClosed(player, event)
 }
 
 func (b *MusicBot) onVoiceStateUpdate(event *events.GuildVoiceStateUpdate) {
-	// only handle bot voice state updates
+	// other users joining or leaving, check if the bot is alone now
 	if event.VoiceState.UserID != b.Client.ApplicationID() {
+		b.Idle.CheckAlone(event.VoiceState.GuildID)
 		return
 	}
 	// update lavalink with the voice state update
 	b.Lavalink.OnVoiceStateUpdate(context.TODO(), event.VoiceState.GuildID, event.VoiceState.ChannelID, event.VoiceState.SessionID)
 
+	// the bot may have been moved to an empty channel
+	if event.VoiceState.ChannelID != nil {
+		b.Idle.CheckAlone(event.VoiceState.GuildID)
+	}
+
 	// if the bot left the voice channel, delete the queue
 	if event.VoiceState.ChannelID == nil {
-		b.Queues.Delete(event.VoiceState.GuildID)
+		b.cleanupGuild(event.VoiceState.GuildID)
+	}
+}
+
+// forgets the queue and player state of the guild, called when the bot left its voice channel
+func (b *MusicBot) cleanupGuild(guildID snowflake.ID) {
+	b.Queues.Delete(guildID)
+	b.Nodes.deleteVoiceServer(guildID)
+	b.Announcer.EndSession(guildID)
+	b.Filters.Clear(guildID)
+	b.Idle.Reset(guildID)
+	b.VoteSkips.Reset(guildID)
+	b.Recovery.Reset(guildID)
+	b.Voice.Reset(guildID)
+
+	// the players are disconnected on shutdown, their queues are restored on the next start
+	if b.closing() {
+		return
+	}
+
+	if err := b.Store.Delete(context.TODO(), guildID); err != nil {
+		msg := "error while deleting stored queue"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
 	}
 }
 
 func (b *MusicBot) onVoiceServerUpdate(event *events.VoiceServerUpdate) {
+	if event.Endpoint == nil {
+		return
+	}
+	// remember the voice server, so the player can be moved to another node
+	b.Nodes.setVoiceServer(event.GuildID, event.Token, *event.Endpoint)
+
 	b.Lavalink.OnVoiceServerUpdate(context.TODO(), event.GuildID, event.Token, *event.Endpoint)
+
+	// continue where the player was if the bot rejoined after losing its voice session
+	b.Voice.OnVoiceServer(event.GuildID)
+}
+
+// returns the best healthy lavalink node for the guild
+func (b *MusicBot) BestNode(guildID snowflake.ID) disgolink.Node {
+	if node := b.Nodes.BestNode(guildID, ""); node != nil {
+		return node
+	}
+	return b.Lavalink.BestNode()
+}
+
+// returns the player of the guild, creating it on the best healthy node if it doesn't exist yet
+func (b *MusicBot) Player(guildID snowflake.ID) disgolink.Player {
+	if player := b.Lavalink.ExistingPlayer(guildID); player != nil {
+		return player
+	}
+	return b.Lavalink.PlayerOnNode(b.BestNode(guildID), guildID)
 }
 
 // handle starting the bot
@@ -178,40 +383,125 @@ func (b *MusicBot) Start(ctx context.Context) error {
 	err := b.Client.OpenGateway(connectCtx)
 	if err != nil {
 		msg := "error while opening gateway"
-		logger.Error(msg, eris.Wrap(err, msg))
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
 	}
-	// defer b.Client.Close(ctx)
 
-	node, err := b.Lavalink.AddNode(ctx, disgolink.NodeConfig{
-		Name:     k.String("lavalink.node.name"),
-		Address:  k.String("lavalink.node.address"),
-		Password: k.String("lavalink.node.password"),
-		Secure:   false,
-	})
-	if err != nil {
-		msg := "error while adding lavalink node"
-		err = eris.Wrap(err, msg)
-		logger.Error(msg, err)
+	// connect to all configured lavalink nodes
+	for _, config := range loadNodeConfigs() {
+		b.Nodes.addConfig(config)
+
+		nodeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		node, err := b.Lavalink.AddNode(nodeCtx, disgolink.NodeConfig{
+			Name:     config.Name,
+			Address:  config.Address,
+			Password: config.Password,
+			Secure:   config.Secure,
+		})
+		cancel()
+		if err != nil {
+			msg := "error while adding lavalink node"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("node", config.Name))
+			continue
+		}
+		b.lavalinkNodes[config.Name] = node
+
+		version, err := node.Version(ctx)
+		if err != nil {
+			msg := "error while getting lavalink node version"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("node", config.Name))
+			continue
+		}
+		logger.Info(fmt.Sprintf("Lavalink version: %s", version), slog.String("node", config.Name))
 	}
-	// defer node.Close()
-	b.lavalinkNodes["test"] = node
 
-	version, err := node.Version(ctx)
-	if err != nil {
-		msg := "error while getting lavalink node version"
-		logger.Error(msg, eris.Wrap(err, msg))
+	if len(b.lavalinkNodes) == 0 {
+		return eris.New("could not connect to any lavalink node")
 	}
-	logger.Info(fmt.Sprintf("Lavalink version: %s", version))
+
+	// resume the queues from before the last restart
+	if err = b.RestoreQueues(ctx); err != nil {
+		msg := "error while restoring queues"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
+	}
+	go b.saveQueuesLoop(k.Duration("storage.interval"))
 
 	return nil
 }
 
-// a clean shutdown of the bot
-func (b *MusicBot) Close(ctx context.Context) {
-	// close gateway connection
-	b.Client.Close(ctx)
+// reports whether the bot is shutting down
+func (b *MusicBot) closing() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// a clean shutdown of the bot. Queues are persisted, the guilds are told about
+// the restart and the players are disconnected before lavalink and the gateway are closed.
+// returns an error if a step failed or ctx expired, the remaining steps are still run.
+// only the first call closes the bot, later calls return nil right away.
+func (b *MusicBot) Close(ctx context.Context) error {
+	var err error
+	b.closeOnce.Do(func() {
+		err = b.close(ctx)
+	})
+	return err
+}
+
+func (b *MusicBot) close(ctx context.Context) error {
+	close(b.done)
+	var errs []error
+
+	// persist queues, so they can be restored on the next start
+	var guildIDs []snowflake.ID
+	for _, guildID := range b.Queues.GuildIDs() {
+		if _, ok := b.queueState(guildID); ok {
+			guildIDs = append(guildIDs, guildID)
+		}
+	}
+	b.SaveQueues(ctx)
+
+	for _, guildID := range guildIDs {
+		b.Announcer.Notify(guildID, "Restarting, the queue continues once I'm back")
+	}
+
+	// collect the players first, they can't be removed while iterating
+	var players []disgolink.Player
+	b.Lavalink.ForPlayers(func(player disgolink.Player) {
+		players = append(players, player)
+	})
+
+	// nodes closed from here on are not failing, don't migrate players
+	b.Nodes.setClosing()
+
+	// disconnect players, the stored queues are kept as the bot is closing
+	for _, player := range players {
+		guildID := player.GuildID()
+		if err := player.Destroy(ctx); err != nil {
+			msg := "error while destroying player"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+			errs = append(errs, eris.Wrap(err, msg))
+		}
+		b.Lavalink.RemovePlayer(guildID)
+
+		if err := b.Client.UpdateVoiceState(ctx, guildID, nil, false, false); err != nil {
+			msg := "error while leaving voice channel"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+			errs = append(errs, eris.Wrap(err, msg))
+		}
+	}
 
 	for _, node := range b.lavalinkNodes {
 		node.Close()
 	}
+
+	// close gateway connection
+	b.Client.Close(ctx)
+
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, eris.Wrap(err, "shutdown did not finish in time"))
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/gateway"
+)
+
+func TestMain(m *testing.M) {
+	// keep the test output readable
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	setDefaultConfig()
+	os.Exit(m.Run())
+}
+
+// creates a bot which isn't connected to discord or lavalink, storing its data in a temporary directory
+func newTestBot(t *testing.T) *MusicBot {
+	t.Helper()
+
+	if err := k.Set("storage.path", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the application id is read from the first part of the token
+	token := base64.RawStdEncoding.EncodeToString([]byte("1000")) + ".test.token"
+	// a gateway which is never opened, so the gateway url isn't requested from discord
+	b, err := NewMusicBot(token, bot.WithGateway(gateway.New(token, nil, nil)))
+	if err != nil {
+		t.Fatalf("creating bot: %s", err)
+	}
+	return b
+}
+
+func TestMusicBotCloseTwice(t *testing.T) {
+	b := newTestBot(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := b.Close(ctx); err != nil {
+		t.Fatalf("first Close: %s", err)
+	}
+	if !b.closing() {
+		t.Error("bot isn't closing after Close")
+	}
+	// e.g. a failed start and the shutdown both closing the bot
+	if err := b.Close(ctx); err != nil {
+		t.Errorf("second Close: %s", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/disgoorg/disgo/discord"
@@ -14,9 +16,42 @@ import (
 	"github.com/disgoorg/disgolink/v3/lavalink"
 	"github.com/disgoorg/json"
 	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
 	"github.com/rotisserie/eris"
 )
 
+// search sources users can pick from
+var searchSourceChoices = []discord.ApplicationCommandOptionChoiceString{
+	{
+		Name:  "YouTube",
+		Value: string(lavalink.SearchTypeYouTube),
+	},
+	{
+		Name:  "YouTube Music",
+		Value: string(lavalink.SearchTypeYouTubeMusic),
+	},
+	{
+		Name:  "SoundCloud",
+		Value: string(lavalink.SearchTypeSoundCloud),
+	},
+	{
+		Name:  "Deezer",
+		Value: "dzsearch",
+	},
+	{
+		Name:  "Deezer ISRC",
+		Value: "dzisrc",
+	},
+	{
+		Name:  "Spotify",
+		Value: "spsearch",
+	},
+	{
+		Name:  "AppleMusic",
+		Value: "amsearch",
+	},
+}
+
 var slashCommands = []discord.ApplicationCommandCreate{
 	discord.SlashCommandCreate{
 		Name:        "play",
@@ -31,36 +66,7 @@ var slashCommands = []discord.ApplicationCommandCreate{
 				Name:        "source",
 				Description: "The source to search on",
 				Required:    false,
-				Choices: []discord.ApplicationCommandOptionChoiceString{
-					{
-						Name:  "YouTube",
-						Value: string(lavalink.SearchTypeYouTube),
-					},
-					{
-						Name:  "YouTube Music",
-						Value: string(lavalink.SearchTypeYouTubeMusic),
-					},
-					{
-						Name:  "SoundCloud",
-						Value: string(lavalink.SearchTypeSoundCloud),
-					},
-					{
-						Name:  "Deezer",
-						Value: "dzsearch",
-					},
-					{
-						Name:  "Deezer ISRC",
-						Value: "dzisrc",
-					},
-					{
-						Name:  "Spotify",
-						Value: "spsearch",
-					},
-					{
-						Name:  "AppleMusic",
-						Value: "amsearch",
-					},
-				},
+				Choices:     searchSourceChoices,
 			},
 		},
 	},
@@ -99,7 +105,521 @@ var slashCommands = []discord.ApplicationCommandCreate{
 	},
 	discord.SlashCommandCreate{
 		Name:        "queue",
-		Description: "Displays the current queue",
+		Description: "Manages the queue",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "view",
+				Description: "Displays the current queue",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "export",
+				Description: "Exports the queue as files to back it up or share it",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "import",
+				Description: "Adds the tracks of an exported queue or a list of links to the queue",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionAttachment{
+						Name:        "file",
+						Description: "A queue.json or m3u file from /queue export, or a text file with one link per line",
+						Required:    true,
+					},
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "skipto",
+		Description: "Skips to a position in the queue, removing all tracks before it",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "position",
+				Description: "The position in the queue to skip to",
+				Required:    true,
+				MinValue:    json.Ptr(1),
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "jump",
+		Description: "Plays the track at a position in the queue, keeping the tracks before it",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "position",
+				Description: "The position in the queue to play",
+				Required:    true,
+				MinValue:    json.Ptr(1),
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "remove",
+		Description: "Removes a track or a range of tracks from the queue",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "position",
+				Description: "The position, or a range like 3-7, to remove",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "move",
+		Description: "Moves a track to another position in the queue",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "from",
+				Description: "The position of the track to move",
+				Required:    true,
+				MinValue:    json.Ptr(1),
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "to",
+				Description: "The position to move the track to",
+				Required:    true,
+				MinValue:    json.Ptr(1),
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "clear",
+		Description: "Removes all tracks from the queue",
+	},
+	discord.SlashCommandCreate{
+		Name:        "loop",
+		Description: "Sets the loop mode of the queue",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "mode",
+				Description: "The loop mode to set",
+				Required:    true,
+				Choices: []discord.ApplicationCommandOptionChoiceString{
+					{
+						Name:  "Off",
+						Value: string(QueueTypeNormal),
+					},
+					{
+						Name:  "Track",
+						Value: string(QueueTypeRepeatTrack),
+					},
+					{
+						Name:  "Queue",
+						Value: string(QueueTypeRepeatQueue),
+					},
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "seek",
+		Description: "Seeks to a position in the current song",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "position",
+				Description: "The position to seek to, like 1:23, 1h2m3s or 83",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "forward",
+		Description: "Fast-forwards the current song",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "time",
+				Description: "How far to fast-forward, like 0:30, 30s or 30",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "rewind",
+		Description: "Rewinds the current song",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "time",
+				Description: "How far to rewind, like 0:30, 30s or 30",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "filter",
+		Description: "Changes the audio filters of the player",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "preset",
+				Description: "Applies a filter preset",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The preset to apply",
+						Required:    true,
+						Choices: []discord.ApplicationCommandOptionChoiceString{
+							{
+								Name:  "Bass Boost",
+								Value: filterBassBoost,
+							},
+							{
+								Name:  "Nightcore",
+								Value: filterNightcore,
+							},
+							{
+								Name:  "Vaporwave",
+								Value: filterVaporwave,
+							},
+							{
+								Name:  "8D",
+								Value: filter8D,
+							},
+							{
+								Name:  "Karaoke",
+								Value: filterKaraoke,
+							},
+							{
+								Name:  "Tremolo",
+								Value: filterTremolo,
+							},
+						},
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "equalizer",
+				Description: "Sets the gain of an equalizer band",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionInt{
+						Name:        "band",
+						Description: "The band to change, 0 is 25 Hz and 14 is 16 kHz",
+						Required:    true,
+						MinValue:    json.Ptr(0),
+						MaxValue:    json.Ptr(14),
+					},
+					discord.ApplicationCommandOptionFloat{
+						Name:        "gain",
+						Description: "The gain of the band, 0 is unchanged",
+						Required:    true,
+						MinValue:    json.Ptr(-0.25),
+						MaxValue:    json.Ptr(1.0),
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "timescale",
+				Description: "Changes the speed, pitch and rate of the playback",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionFloat{
+						Name:        "speed",
+						Description: "The playback speed, 1 is unchanged",
+						MinValue:    json.Ptr(0.1),
+						MaxValue:    json.Ptr(5.0),
+					},
+					discord.ApplicationCommandOptionFloat{
+						Name:        "pitch",
+						Description: "The pitch, 1 is unchanged",
+						MinValue:    json.Ptr(0.1),
+						MaxValue:    json.Ptr(5.0),
+					},
+					discord.ApplicationCommandOptionFloat{
+						Name:        "rate",
+						Description: "The rate, 1 is unchanged",
+						MinValue:    json.Ptr(0.1),
+						MaxValue:    json.Ptr(5.0),
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "clear",
+				Description: "Removes all filters",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "list",
+				Description: "Shows the active filters",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "dj",
+		Description: "Manages the DJ role, which is needed to control the player",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "set",
+				Description: "Sets the DJ role",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionRole{
+						Name:        "role",
+						Description: "The role DJs have",
+						Required:    true,
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "clear",
+				Description: "Removes the DJ role, so everyone can control the player",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "announce",
+		Description: "Turns now playing announcements on or off",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether to announce every track that starts playing",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "settings",
+		Description: "Manages the settings of this server",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "view",
+				Description: "Shows the settings",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "set",
+				Description: "Changes one or more settings",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionInt{
+						Name:        settingDefaultVolume,
+						Description: "The volume new players start with",
+						MinValue:    json.Ptr(1),
+						MaxValue:    json.Ptr(100),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        settingSearchSource,
+						Description: "The source to search on when /play gets no link",
+						Choices:     searchSourceChoices,
+					},
+					discord.ApplicationCommandOptionChannel{
+						Name:         settingAnnounceChannel,
+						Description:  "The channel to announce tracks in",
+						ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText},
+					},
+					discord.ApplicationCommandOptionBool{
+						Name:        settingAnnouncements,
+						Description: "Whether to announce every track that starts playing",
+					},
+					discord.ApplicationCommandOptionRole{
+						Name:        settingDJRole,
+						Description: "The role needed to control the player",
+					},
+					discord.ApplicationCommandOptionInt{
+						Name:        settingMaxQueueLength,
+						Description: "The maximum amount of tracks in the queue",
+						MinValue:    json.Ptr(1),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        settingMaxTrackDuration,
+						Description: "The maximum length of a track, e.g. 10:00",
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        settingIdleTimeout,
+						Description: "How long to stay in the voice channel with nothing playing, e.g. 5m",
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        settingAllowedSources,
+						Description: "Comma separated sources tracks may come from, e.g. youtube,soundcloud",
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        settingBlockedSources,
+						Description: "Comma separated sources tracks may not come from, e.g. soundcloud,http",
+					},
+					discord.ApplicationCommandOptionBool{
+						Name:        settingAutoplay,
+						Description: "Whether to play related tracks when the queue runs out",
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "reset",
+				Description: "Resets one or all settings to the default",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "setting",
+						Description: "The setting to reset, all settings are reset if not given",
+						Choices: []discord.ApplicationCommandOptionChoiceString{
+							{Name: "Default volume", Value: settingDefaultVolume},
+							{Name: "Search source", Value: settingSearchSource},
+							{Name: "Announce channel", Value: settingAnnounceChannel},
+							{Name: "Announcements", Value: settingAnnouncements},
+							{Name: "DJ role", Value: settingDJRole},
+							{Name: "Max queue length", Value: settingMaxQueueLength},
+							{Name: "Max track duration", Value: settingMaxTrackDuration},
+							{Name: "Idle timeout", Value: settingIdleTimeout},
+							{Name: "Allowed sources", Value: settingAllowedSources},
+							{Name: "Blocked sources", Value: settingBlockedSources},
+							{Name: "Autoplay", Value: settingAutoplay},
+						},
+					},
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "playlist",
+		Description: "Manages saved playlists",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "create",
+				Description: "Creates an empty playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "save",
+				Description: "Saves the current queue as a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "add",
+				Description: "Adds a track to a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        "track",
+						Description: "The song link or search query, the current song is added if not given",
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "remove",
+				Description: "Removes tracks from a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        "position",
+						Description: "The position of the track, or a range like 3-7",
+						Required:    true,
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "list",
+				Description: "Shows your playlists or the tracks of a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist to show the tracks of",
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "play",
+				Description: "Adds the tracks of a playlist to the queue",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					discord.ApplicationCommandOptionBool{
+						Name:        "shuffle",
+						Description: "Whether to shuffle the tracks",
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "delete",
+				Description: "Deletes a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					playlistScopeOption,
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "rename",
+				Description: "Renames a playlist",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "name",
+						Description: "The name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        "new-name",
+						Description: "The new name of the playlist",
+						Required:    true,
+						MaxLength:   json.Ptr(100),
+					},
+					playlistScopeOption,
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "autoplay",
+		Description: "Turns playing related tracks when the queue runs out on or off",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether to play related tracks when the queue runs out",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "previous",
+		Description: "Plays the previous song again",
+	},
+	discord.SlashCommandCreate{
+		Name:        "history",
+		Description: "Shows and requeues recently played songs",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "list",
+				Description: "Shows the recently played songs",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "requeue",
+				Description: "Adds recently played songs back to the queue",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "position",
+						Description: "The position in /history list, or a range like 1-5",
+						Required:    true,
+					},
+				},
+			},
+		},
 	},
 	discord.SlashCommandCreate{
 		Name:        "skip",
@@ -143,6 +663,8 @@ func (b *MusicBot) buildCommandHandler() *handler.Mux {
 	cmds := CmdHandler{musicBot: b}
 	// create new handler mux
 	r := handler.New()
+	// check permissions before any handler runs
+	r.Use(b.Permissions.Middleware)
 
 	r.Command("/play", cmds.play)
 	r.Command("/now-playing", cmds.nowPlaying)
@@ -151,8 +673,64 @@ func (b *MusicBot) buildCommandHandler() *handler.Mux {
 	r.Command("/disconnect", cmds.disconnect)
 	r.Command("/volume", cmds.volume)
 	r.Command("/shuffle", cmds.shuffle)
-	r.Command("/queue", cmds.queue)
+	r.Route("/queue", func(r handler.Router) {
+		r.Command("/view", cmds.queue)
+		r.Command("/export", cmds.queueExport)
+		r.Command("/import", cmds.queueImport)
+		r.Component("/page/{page}", cmds.queuePage)
+	})
+	r.Command("/skipto", cmds.skipTo)
 	r.Command("/skip", cmds.skip)
+	r.Command("/jump", cmds.jump)
+	r.Command("/remove", cmds.remove)
+	r.Command("/move", cmds.move)
+	r.Command("/clear", cmds.clear)
+	r.Command("/loop", cmds.loop)
+	r.Command("/announce", cmds.announce)
+	r.Command("/autoplay", cmds.autoplay)
+	r.Command("/previous", cmds.previous)
+	r.Route("/history", func(r handler.Router) {
+		r.Command("/list", cmds.historyList)
+		r.Command("/requeue", cmds.historyRequeue)
+	})
+	r.Route("/dj", func(r handler.Router) {
+		r.Command("/set", cmds.djSet)
+		r.Command("/clear", cmds.djClear)
+	})
+	r.Route("/playlist", func(r handler.Router) {
+		r.Command("/create", cmds.playlistCreate)
+		r.Command("/save", cmds.playlistSave)
+		r.Command("/add", cmds.playlistAdd)
+		r.Command("/remove", cmds.playlistRemove)
+		r.Command("/list", cmds.playlistList)
+		r.Command("/play", cmds.playlistPlay)
+		r.Command("/delete", cmds.playlistDelete)
+		r.Command("/rename", cmds.playlistRename)
+	})
+	r.Route("/settings", func(r handler.Router) {
+		r.Command("/view", cmds.settingsView)
+		r.Command("/set", cmds.settingsSet)
+		r.Command("/reset", cmds.settingsReset)
+	})
+	r.Command("/seek", cmds.seek)
+	r.Command("/forward", cmds.forward)
+	r.Command("/rewind", cmds.rewind)
+	r.Route("/filter", func(r handler.Router) {
+		r.Command("/preset", cmds.filterPreset)
+		r.Command("/equalizer", cmds.filterEqualizer)
+		r.Command("/timescale", cmds.filterTimescale)
+		r.Command("/clear", cmds.filterClear)
+		r.Command("/list", cmds.filterList)
+	})
+
+	r.Component("/play/pick/{id}", cmds.pickSearchResult)
+	r.Component("/player/pause", cmds.panelPause)
+	r.Component("/player/skip", cmds.panelSkip)
+	r.Component("/player/voteskip", cmds.panelVoteSkip)
+	r.Component("/player/stop", cmds.panelStop)
+	r.Component("/player/shuffle", cmds.panelShuffle)
+	r.Component("/player/loop", cmds.panelLoop)
+	r.Component("/player/volume/{direction}", cmds.panelVolume)
 
 	return r
 }
@@ -167,7 +745,14 @@ func (h CmdHandler) play(event *handler.CommandEvent) error {
 	if source, ok := data.OptString("source"); ok {
 		identifier = lavalink.SearchType(source).Apply(identifier)
 	} else if !urlPattern.MatchString(identifier) && !searchPattern.MatchString(identifier) {
-		identifier = lavalink.SearchTypeYouTube.Apply(identifier)
+		identifier = h.musicBot.searchType(*event.GuildID()).Apply(identifier)
+	}
+
+	// reject blocked sources before asking lavalink for anything
+	if source := identifierSource(identifier); !h.musicBot.sourceAllowed(*event.GuildID(), source) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Playing from `%s` isn't allowed on this server", source),
+		})
 	}
 
 	voiceState, ok := h.musicBot.Client.Caches().VoiceState(*event.GuildID(), event.User().ID)
@@ -177,39 +762,42 @@ func (h CmdHandler) play(event *handler.CommandEvent) error {
 		})
 	}
 
+	if wait, ok := h.musicBot.playLimits.allow(*event.GuildID(), event.User().ID, k.Int("play.ratelimit.count"), k.Duration("play.ratelimit.window")); !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("You are using /play too often, try again in %s", wait.Round(time.Second)),
+			Flags:   discord.MessageFlagEphemeral,
+		})
+	}
+
 	if err := event.DeferCreateMessage(false); err != nil {
 		return err
 	}
 
+	// announce tracks in the channel the session was started from
+	h.musicBot.Announcer.SetChannel(*event.GuildID(), event.ChannelID())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var toPlay []lavalink.Track
-	bestNode := h.musicBot.Lavalink.BestNode()
-
-	// results, err := bestNode.LoadTracks(ctx, identifier)
-	// if err != nil {
-	// 	return err
-	// }
+	var (
+		toPlay        []lavalink.Track
+		searchResults []lavalink.Track
+	)
+	bestNode := h.musicBot.BestNode(*event.GuildID())
 
 	bestNode.LoadTracksHandler(ctx, identifier, disgolink.NewResultHandler(
 		func(track lavalink.Track) {
-			// _, _ = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
-			// 	Content: json.Ptr(fmt.Sprintf("Loaded track: [`%s`](<%s>)", track.Info.Title, *track.Info.URI)),
-			// })
 			toPlay = append(toPlay, track)
 		},
 		func(playlist lavalink.Playlist) {
-			// _, _ = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
-			// 	Content: json.Ptr(fmt.Sprintf("Loaded playlist: `%s` with `%d` tracks", playlist.Info.Name, len(playlist.Tracks))),
-			// })
-
 			toPlay = append(toPlay, playlist.Tracks...)
 		},
 		func(tracks []lavalink.Track) {
-			// _, _ = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
-			// 	Content: json.Ptr(fmt.Sprintf("Loaded search result: [`%s`](<%s>)", tracks[0].Info.Title, *tracks[0].Info.URI)),
-			// })
+			// let the user pick one of the results
+			if k.String("play.search.mode") == searchModePicker {
+				searchResults = tracks
+				return
+			}
 
 			// use first search result
 			toPlay = append(toPlay, tracks[0])
@@ -226,18 +814,49 @@ func (h CmdHandler) play(event *handler.CommandEvent) error {
 		},
 	))
 
+	if len(searchResults) > 0 {
+		return h.showSearchPicker(event, *voiceState.ChannelID, searchResults)
+	}
+
 	// check if there are any tracks to play
 	if len(toPlay) == 0 {
 		return nil
 	}
 
-	// join vc
-	if err := h.musicBot.Client.UpdateVoiceState(context.TODO(), *event.GuildID(), voiceState.ChannelID, false, false); err != nil {
-		return err
+	msg, err := h.enqueue(*event.GuildID(), *voiceState.ChannelID, withRequest(toPlay, TrackRequest{
+		UserID:        event.User().ID,
+		ChannelID:     event.ChannelID(),
+		InteractionID: event.ID(),
+		RequestedAt:   time.Now(),
+	}))
+	if err != nil {
+		logger.Error("Failed to play track", tint.Err(eris.Wrap(err, "failed to play track")))
+	}
+
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: &msg,
+	})
+	return err
+}
+
+// joins the voice channel and plays the first track if nothing is playing yet, the remaining tracks are added to the queue.
+// returns the message to show to the user, even if an error occurred.
+func (h CmdHandler) enqueue(guildID snowflake.ID, channelID snowflake.ID, toPlay []lavalink.Track) (string, error) {
+	// drop the tracks breaking the queue limits and tell the user why
+	toPlay, notes := h.musicBot.limitTracks(guildID, toPlay)
+	if len(toPlay) == 0 {
+		return "Nothing was added to the queue\n" + strings.Join(notes, "\n"), nil
 	}
 
-	// get current player
-	player := h.musicBot.Lavalink.Player(*event.GuildID())
+	// create the player on a healthy node before joining,
+	// otherwise the voice events would create it on any node
+	isNew := h.musicBot.Lavalink.ExistingPlayer(guildID) == nil
+	player := h.musicBot.Player(guildID)
+
+	// join vc
+	if err := h.musicBot.Client.UpdateVoiceState(context.TODO(), guildID, &channelID, false, false); err != nil {
+		return "Error while joining your voice channel", err
+	}
 
 	// get current track
 	track := player.Track()
@@ -251,102 +870,260 @@ func (h CmdHandler) play(event *handler.CommandEvent) error {
 		// remove first track from queue
 		toPlay = toPlay[1:]
 
+		opts := []lavalink.PlayerUpdateOpt{lavalink.WithTrack(*track)}
+		// new players start with the default volume of the guild
+		if volume := h.musicBot.Settings.Get(guildID).DefaultVolume; isNew && volume > 0 {
+			opts = append(opts, lavalink.WithVolume(volume))
+		}
+
 		// play selected track
-		err := player.Update(context.TODO(), lavalink.WithTrack(*track))
+		err := player.Update(context.TODO(), opts...)
 		if err != nil {
-			logger.Error("Failed to play track", eris.Wrap(err, "failed to play track"))
-
 			// notify user about error
-			return event.CreateMessage(discord.MessageCreate{
-				Content: fmt.Sprintf("Error while playing: `%s`", track.Info.Title),
-			})
+			return fmt.Sprintf("Error while playing: `%s`", track.Info.Title), err
 		}
 
-		msg = fmt.Sprintf("Now playing: [`%s`](<%s>)", track.Info.Title, *track.Info.URI)
-		logger.Info("Now playing track", slog.String("title", track.Info.Title), slog.String("uri", *track.Info.URI))
+		msg = fmt.Sprintf("Now playing: %s", formatTrack(*track))
+		logger.Info("Now playing track", slog.String("title", track.Info.Title), slog.String("uri", trackURI(*track)))
 
 	}
 
-	// add track(s) to queue
-	queue := h.musicBot.Queues.Get(*event.GuildID())
-	queue.Add(toPlay...)
+	// add track(s) to queue, requested tracks play before the ones autoplay queued
+	queue := h.musicBot.Queues.Get(guildID)
+	queue.AddBefore(isAutoplayTrack, toPlay...)
 
 	switch len(toPlay) {
 	case 0:
-		_, err := h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
-			Content: &msg,
-		})
-		return err
 	case 1:
-		msg += fmt.Sprintf("\nAdded track to queue: [`%s`](<%s>)", toPlay[0].Info.Title, *toPlay[0].Info.URI)
-		logger.Info("Added track to queue", slog.String("title", toPlay[0].Info.Title), slog.String("uri", *toPlay[0].Info.URI))
+		msg += fmt.Sprintf("\nAdded track to queue: %s", formatTrack(toPlay[0]))
+		logger.Info("Added track to queue", slog.String("title", toPlay[0].Info.Title), slog.String("uri", trackURI(toPlay[0])))
 	default:
 		msg += fmt.Sprintf("\nAdded `%d` tracks to queue", len(toPlay))
 		logger.Info("Added tracks to queue", slog.Int("count", len(toPlay)))
 	}
 
-	_, err := h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
-		Content: &msg,
-	})
-	return err
+	if len(notes) > 0 {
+		msg += "\n" + strings.Join(notes, "\n")
+	}
+
+	return msg, nil
 }
 
-func (h CmdHandler) queue(event *handler.CommandEvent) error {
+func (h CmdHandler) skip(event *handler.CommandEvent) error {
+	logger.Info("Received /skip command")
+
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
 	queue := h.musicBot.Queues.Get(*event.GuildID())
-	if queue == nil {
+	if player == nil || queue == nil {
 		return event.CreateMessage(discord.MessageCreate{
 			Content: "No player found",
 		})
 	}
 
-	if len(queue.Tracks) == 0 {
+	amount, ok := event.SlashCommandInteractionData().OptInt("amount")
+	if !ok {
+		amount = 1
+	}
+
+	// users may skip their own tracks, everything else needs a DJ
+	tracks := queue.Tracks()
+	skipped := tracks[:max(min(amount, len(tracks))-1, 0)]
+	if track := player.Track(); track != nil {
+		skipped = append(skipped, *track)
+	}
+	if !h.musicBot.Permissions.CanSkip(*event.GuildID(), *event.Member(), skipped...) {
+		// everyone else may vote to skip the current track
+		if voteSkipEnabled() {
+			msg, _ := h.musicBot.voteSkip(*event.GuildID(), event.User().ID)
+			return event.CreateMessage(discord.MessageCreate{
+				Content: msg,
+			})
+		}
+
 		return event.CreateMessage(discord.MessageCreate{
-			Content: "No tracks in queue",
+			Content: "Only DJs can skip tracks requested by others",
+			Flags:   discord.MessageFlagEphemeral,
 		})
 	}
+	logger.Info("Skipping tracks", slog.Int("amount", amount))
 
-	var tracks string
-	for i, track := range queue.Tracks {
-		tracks += fmt.Sprintf("%d. [`%s`](<%s>)\n", i+1, track.Info.Title, *track.Info.URI)
+	// skip and play atomically, so a track ending at the same time can't advance the queue twice
+	_, ok, err := queue.SkipAndPlay(amount, func(track lavalink.Track) error {
+		return player.Update(context.TODO(), lavalink.WithTrack(track))
+	})
+	if !ok && h.musicBot.Autoplay.SkipToRelated(player) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Skipped track, autoplay is looking for related tracks",
+		})
+	}
+	if !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No tracks in queue",
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while skipping track: `%s`", err),
+		})
 	}
 
 	return event.CreateMessage(discord.MessageCreate{
-		Content: fmt.Sprintf("Queue `%s`:\n%s", queue.Type, tracks),
+		Content: "Skipped track",
 	})
 }
 
-func (h CmdHandler) skip(event *handler.CommandEvent) error {
-	logger.Info("Received /skip command")
+func (h CmdHandler) skipTo(event *handler.CommandEvent) error {
+	logger.Info("Received /skipto command")
 
 	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No player found",
+		})
+	}
+
 	queue := h.musicBot.Queues.Get(*event.GuildID())
-	if player == nil || queue == nil {
+	position := event.SlashCommandInteractionData().Int("position")
+	if position > queue.Len() {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Position must be between `1` and `%d`", queue.Len()),
+		})
+	}
+
+	track, ok, err := queue.SkipAndPlay(position, func(track lavalink.Track) error {
+		return player.Update(context.TODO(), lavalink.WithTrack(track))
+	})
+	if !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No tracks in queue",
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while skipping track: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Skipped to: %s", formatTrack(track)),
+	})
+}
+
+func (h CmdHandler) jump(event *handler.CommandEvent) error {
+	logger.Info("Received /jump command")
+
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
 		return event.CreateMessage(discord.MessageCreate{
 			Content: "No player found",
 		})
 	}
 
-	amount, ok := event.SlashCommandInteractionData().OptInt("amount")
+	queue := h.musicBot.Queues.Get(*event.GuildID())
+	position := event.SlashCommandInteractionData().Int("position")
+
+	track, ok, err := queue.JumpAndPlay(position-1, func(track lavalink.Track) error {
+		return player.Update(context.TODO(), lavalink.WithTrack(track))
+	})
 	if !ok {
-		amount = 1
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Position must be between `1` and `%d`", queue.Len()),
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while jumping to track: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Jumped to: %s", formatTrack(track)),
+	})
+}
+
+func (h CmdHandler) remove(event *handler.CommandEvent) error {
+	logger.Info("Received /remove command")
+
+	from, to, err := parsePositionRange(event.SlashCommandInteractionData().String("position"))
+	if eris.Is(err, errReversedRange) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: reversedRangeMessage(from, to),
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Position must be a number like `3` or a range like `3-7`",
+		})
+	}
+
+	queue := h.musicBot.Queues.Get(*event.GuildID())
+
+	// users may remove their own tracks, everything else needs a DJ
+	if tracks := queue.Tracks(); from >= 1 && from <= to && to <= len(tracks) {
+		if !h.musicBot.Permissions.CanManageTracks(*event.GuildID(), *event.Member(), tracks[from-1:to]...) {
+			return event.CreateMessage(discord.MessageCreate{
+				Content: "Only DJs can remove tracks requested by others",
+				Flags:   discord.MessageFlagEphemeral,
+			})
+		}
 	}
-	logger.Info("Skipping tracks", slog.Int("amount", amount))
 
-	track, ok := queue.Skip(amount)
+	removed, ok := queue.Remove(from-1, to-1)
 	if !ok {
 		return event.CreateMessage(discord.MessageCreate{
-			Content: "No tracks in queue",
+			Content: fmt.Sprintf("Positions must be between `1` and `%d`", queue.Len()),
 		})
 	}
 
-	if err := player.Update(context.TODO(), lavalink.WithTrack(track)); err != nil {
+	if len(removed) == 1 {
 		return event.CreateMessage(discord.MessageCreate{
-			Content: fmt.Sprintf("Error while skipping track: `%s`", err),
+			Content: fmt.Sprintf("Removed track from queue: %s", formatTrack(removed[0])),
+		})
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Removed `%d` tracks from queue", len(removed)),
+	})
+}
+
+func (h CmdHandler) move(event *handler.CommandEvent) error {
+	logger.Info("Received /move command")
+
+	data := event.SlashCommandInteractionData()
+	from, to := data.Int("from"), data.Int("to")
+
+	queue := h.musicBot.Queues.Get(*event.GuildID())
+	track, ok := queue.Move(from-1, to-1)
+	if !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Positions must be between `1` and `%d`", queue.Len()),
 		})
 	}
 
 	return event.CreateMessage(discord.MessageCreate{
-		Content: "Skipped track",
+		Content: fmt.Sprintf("Moved %s to position `%d`", formatTrack(track), to),
+	})
+}
+
+func (h CmdHandler) clear(event *handler.CommandEvent) error {
+	logger.Info("Received /clear command")
+
+	h.musicBot.Queues.Get(*event.GuildID()).Clear()
+	return event.CreateMessage(discord.MessageCreate{
+		Content: "Queue cleared",
+	})
+}
+
+func (h CmdHandler) loop(event *handler.CommandEvent) error {
+	logger.Info("Received /loop command")
+
+	queueType := QueueType(event.SlashCommandInteractionData().String("mode"))
+	queue := h.musicBot.Queues.Get(*event.GuildID())
+	queue.SetType(queueType)
+
+	h.musicBot.Announcer.Refresh(*event.GuildID())
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Loop mode set to `%s`", queueType),
 	})
 }
 
@@ -358,7 +1135,7 @@ func (h CmdHandler) pause(event *handler.CommandEvent) error {
 		})
 	}
 
-	if err := player.Update(context.TODO(), lavalink.WithPaused(!player.Paused())); err != nil {
+	if err := h.musicBot.setPaused(context.TODO(), player, !player.Paused()); err != nil {
 		return event.CreateMessage(discord.MessageCreate{
 			Content: fmt.Sprintf("Error while pausing: `%s`", err),
 		})
@@ -388,6 +1165,8 @@ func (h CmdHandler) volume(event *handler.CommandEvent) error {
 		})
 	}
 
+	h.musicBot.Announcer.Refresh(*event.GuildID())
+
 	return event.CreateMessage(discord.MessageCreate{
 		Content: fmt.Sprintf("Volume set to `%d`", volume),
 	})
@@ -423,6 +1202,8 @@ func (h CmdHandler) stop(event *handler.CommandEvent) error {
 		})
 	}
 
+	h.musicBot.Idle.StartIdle(*event.GuildID())
+
 	return event.CreateMessage(discord.MessageCreate{
 		Content: "Player stopped",
 	})
@@ -466,14 +1247,62 @@ func (h CmdHandler) nowPlaying(event *handler.CommandEvent) error {
 		})
 	}
 
+	content := fmt.Sprintf("Now playing: %s\n\n %s / %s\nLoop: `%s`", formatTrack(*track), formatPosition(player.Position()), formatPosition(track.Info.Length), h.musicBot.Queues.Get(*event.GuildID()).Type())
+	if requester := formatRequester(*track); requester != "" {
+		content += fmt.Sprintf("\nRequested by %s", requester)
+	}
+	if filters := h.musicBot.Filters.Format(*event.GuildID()); filters != "" {
+		content += fmt.Sprintf("\nFilters: %s", filters)
+	}
+
 	return event.CreateMessage(discord.MessageCreate{
-		Content: fmt.Sprintf("Now playing: [`%s`](<%s>)\n\n %s / %s", track.Info.Title, *track.Info.URI, formatPosition(player.Position()), formatPosition(track.Info.Length)),
+		Content: content,
+		// don't ping the requester
+		AllowedMentions: &discord.AllowedMentions{},
 	})
 }
 
+// returned by parsePositionRange for ranges like "7-3"
+var errReversedRange = eris.New("range starts after it ends")
+
+// parses a queue position like "3" or a range like "3-7" into its 1-based bounds.
+// the bounds aren't checked against a queue, only that a range doesn't end before it starts.
+func parsePositionRange(s string) (int, int, error) {
+	fromStr, toStr, isRange := strings.Cut(strings.TrimSpace(s), "-")
+
+	from, err := strconv.Atoi(strings.TrimSpace(fromStr))
+	if err != nil {
+		return 0, 0, eris.Wrap(err, "invalid position")
+	}
+	if !isRange {
+		return from, from, nil
+	}
+
+	to, err := strconv.Atoi(strings.TrimSpace(toStr))
+	if err != nil {
+		return 0, 0, eris.Wrap(err, "invalid position")
+	}
+	// "3--5" is cut into 3 and -5
+	if to < 0 {
+		return 0, 0, eris.New("invalid position")
+	}
+	if to < from {
+		return from, to, errReversedRange
+	}
+	return from, to, nil
+}
+
+// tells the user how to write the reversed range of parsePositionRange
+func reversedRangeMessage(from int, to int) string {
+	return fmt.Sprintf("Ranges go from the lower to the higher position, use `%d-%d` instead of `%d-%d`", to, from, from, to)
+}
+
 func formatPosition(position lavalink.Duration) string {
 	if position == 0 {
 		return "0:00"
 	}
+	if position.Hours() > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", position.Hours(), position.MinutesPart(), position.SecondsPart())
+	}
 	return fmt.Sprintf("%d:%02d", position.Minutes(), position.SecondsPart())
 }
@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/rotisserie/eris"
+)
+
+func TestParsePositionRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		from     int
+		to       int
+		wantErr  bool
+		reversed bool
+	}{
+		{input: "3", from: 3, to: 3},
+		{input: " 3 ", from: 3, to: 3},
+		{input: "0", from: 0, to: 0},
+		{input: "1000", from: 1000, to: 1000},
+		{input: "3-7", from: 3, to: 7},
+		{input: "3 - 7", from: 3, to: 7},
+		{input: "4-4", from: 4, to: 4},
+		{input: "0-2", from: 0, to: 2},
+		{input: "7-3", from: 7, to: 3, wantErr: true, reversed: true},
+		{input: "-5", wantErr: true},
+		{input: "3--5", wantErr: true},
+		{input: "3-", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "1-b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			from, to, err := parsePositionRange(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePositionRange(%q) error = %v, want error %v", tt.input, err, tt.wantErr)
+			}
+			if reversed := eris.Is(err, errReversedRange); reversed != tt.reversed {
+				t.Errorf("parsePositionRange(%q) reversed = %v, want %v", tt.input, reversed, tt.reversed)
+			}
+			if err != nil && !tt.reversed {
+				return
+			}
+			if from != tt.from || to != tt.to {
+				t.Errorf("parsePositionRange(%q) = %d, %d, want %d, %d", tt.input, from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	filterBassBoost = "bassboost"
+	filterNightcore = "nightcore"
+	filterVaporwave = "vaporwave"
+	filter8D        = "8d"
+	filterKaraoke   = "karaoke"
+	filterTremolo   = "tremolo"
+	filterTimescale = "timescale"
+	filterEqualizer = "equalizer"
+)
+
+// filter presets, each one changes some of the players filters
+var filterPresets = map[string]func(filters *lavalink.Filters){
+	filterBassBoost: func(filters *lavalink.Filters) {
+		filters.Equalizer = &lavalink.Equalizer{0.2, 0.15, 0.1, 0.05, 0.0, -0.05}
+	},
+	filterNightcore: func(filters *lavalink.Filters) {
+		filters.Timescale = &lavalink.Timescale{Speed: 1.2, Pitch: 1.2, Rate: 1}
+	},
+	filterVaporwave: func(filters *lavalink.Filters) {
+		filters.Timescale = &lavalink.Timescale{Speed: 0.85, Pitch: 0.8, Rate: 1}
+	},
+	filter8D: func(filters *lavalink.Filters) {
+		// disgolink only supports whole hertz, 1 is the slowest rotation possible
+		filters.Rotation = &lavalink.Rotation{RotationHz: 1}
+	},
+	filterKaraoke: func(filters *lavalink.Filters) {
+		filters.Karaoke = &lavalink.Karaoke{Level: 1, MonoLevel: 1, FilterBand: 220, FilterWidth: 100}
+	},
+	filterTremolo: func(filters *lavalink.Filters) {
+		filters.Tremolo = &lavalink.Tremolo{Frequency: 2, Depth: 0.5}
+	},
+}
+
+// FilterManager tracks the names of the active filters of every guild
+type FilterManager struct {
+	mu      sync.Mutex
+	filters map[snowflake.ID][]string
+}
+
+func NewFilterManager() *FilterManager {
+	return &FilterManager{
+		filters: make(map[snowflake.ID][]string),
+	}
+}
+
+// returns the names of the active filters of the guild
+func (f *FilterManager) Get(guildID snowflake.ID) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.filters[guildID])
+}
+
+// marks the filter as active
+func (f *FilterManager) Add(guildID snowflake.ID, name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// filters changing the timescale or the equalizer replace each other
+	active := slices.DeleteFunc(f.filters[guildID], func(active string) bool {
+		return active == name ||
+			(changesTimescale(name) && changesTimescale(active)) ||
+			(changesEqualizer(name) && changesEqualizer(active))
+	})
+	f.filters[guildID] = append(active, name)
+}
+
+func (f *FilterManager) Clear(guildID snowflake.ID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.filters, guildID)
+}
+
+func changesTimescale(name string) bool {
+	return name == filterNightcore || name == filterVaporwave || name == filterTimescale
+}
+
+func changesEqualizer(name string) bool {
+	return name == filterBassBoost || name == filterEqualizer
+}
+
+// formats the active filters of the guild, empty if there are none
+func (f *FilterManager) Format(guildID snowflake.ID) string {
+	active := f.Get(guildID)
+	if len(active) == 0 {
+		return ""
+	}
+	return "`" + strings.Join(active, "`, `") + "`"
+}
+
+// changes the filters of the guilds player and marks name as active
+func (h CmdHandler) applyFilter(event *handler.CommandEvent, name string, apply func(filters *lavalink.Filters)) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No player found",
+		})
+	}
+
+	filters := player.Filters()
+	apply(&filters)
+	if err := player.Update(context.TODO(), lavalink.WithFilters(filters)); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while applying filter: `%s`", err),
+		})
+	}
+	h.musicBot.Filters.Add(*event.GuildID(), name)
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Active filters: %s", h.musicBot.Filters.Format(*event.GuildID())),
+	})
+}
+
+func (h CmdHandler) filterPreset(event *handler.CommandEvent) error {
+	logger.Info("Received /filter preset command")
+
+	name := event.SlashCommandInteractionData().String("name")
+	preset, ok := filterPresets[name]
+	if !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Unknown filter preset: `%s`", name),
+		})
+	}
+	return h.applyFilter(event, name, preset)
+}
+
+func (h CmdHandler) filterEqualizer(event *handler.CommandEvent) error {
+	logger.Info("Received /filter equalizer command")
+
+	data := event.SlashCommandInteractionData()
+	band, gain := data.Int("band"), data.Float("gain")
+
+	return h.applyFilter(event, filterEqualizer, func(filters *lavalink.Filters) {
+		equalizer := lavalink.Equalizer{}
+		if filters.Equalizer != nil {
+			equalizer = *filters.Equalizer
+		}
+		equalizer[band] = float32(gain)
+		filters.Equalizer = &equalizer
+	})
+}
+
+func (h CmdHandler) filterTimescale(event *handler.CommandEvent) error {
+	logger.Info("Received /filter timescale command")
+
+	data := event.SlashCommandInteractionData()
+	timescale := lavalink.Timescale{Speed: 1, Pitch: 1, Rate: 1}
+	if speed, ok := data.OptFloat("speed"); ok {
+		timescale.Speed = speed
+	}
+	if pitch, ok := data.OptFloat("pitch"); ok {
+		timescale.Pitch = pitch
+	}
+	if rate, ok := data.OptFloat("rate"); ok {
+		timescale.Rate = rate
+	}
+
+	return h.applyFilter(event, filterTimescale, func(filters *lavalink.Filters) {
+		filters.Timescale = &timescale
+	})
+}
+
+func (h CmdHandler) filterClear(event *handler.CommandEvent) error {
+	logger.Info("Received /filter clear command")
+
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No player found",
+		})
+	}
+
+	if err := player.Update(context.TODO(), lavalink.WithFilters(lavalink.Filters{})); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while clearing filters: `%s`", err),
+		})
+	}
+	h.musicBot.Filters.Clear(*event.GuildID())
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: "Filters cleared",
+	})
+}
+
+func (h CmdHandler) filterList(event *handler.CommandEvent) error {
+	active := h.musicBot.Filters.Format(*event.GuildID())
+	if active == "" {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No active filters",
+		})
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Active filters: %s", active),
+	})
+}
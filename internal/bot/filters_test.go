@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestFilterManagerAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		add  []string
+		want []string
+	}{
+		{name: "different filters", add: []string{filterBassBoost, filter8D}, want: []string{filterBassBoost, filter8D}},
+		{name: "same filter twice", add: []string{filter8D, filter8D}, want: []string{filter8D}},
+		{name: "timescale presets", add: []string{filterNightcore, filter8D, filterVaporwave}, want: []string{filter8D, filterVaporwave}},
+		{name: "custom timescale", add: []string{filterNightcore, filterTimescale}, want: []string{filterTimescale}},
+		{name: "bassboost after equalizer", add: []string{filterEqualizer, filterKaraoke, filterBassBoost}, want: []string{filterKaraoke, filterBassBoost}},
+		{name: "equalizer after bassboost", add: []string{filterBassBoost, filterEqualizer}, want: []string{filterEqualizer}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := NewFilterManager()
+			guildID := snowflake.ID(1)
+			for _, name := range tt.add {
+				filters.Add(guildID, name)
+			}
+			if got := filters.Get(guildID); !slices.Equal(got, tt.want) {
+				t.Errorf("active filters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// a track played in a guild
+type HistoryEntry struct {
+	Track    lavalink.Track
+	PlayedAt time.Time
+}
+
+// History keeps the recently played tracks of every guild, at most history.size per guild
+type History struct {
+	mu sync.Mutex
+	// played tracks of each guild, oldest first
+	entries map[snowflake.ID][]HistoryEntry
+}
+
+func NewHistory() *History {
+	return &History{
+		entries: make(map[snowflake.ID][]HistoryEntry),
+	}
+}
+
+// records that the track started playing
+func (h *History) Add(guildID snowflake.ID, track lavalink.Track) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries[guildID]
+	// tracks on repeat or moved to another node start again, only keep them once
+	if len(entries) > 0 && trackKey(entries[len(entries)-1].Track) == trackKey(track) {
+		entries[len(entries)-1].PlayedAt = time.Now()
+		return
+	}
+
+	entries = append(entries, HistoryEntry{Track: track, PlayedAt: time.Now()})
+	if size := max(k.Int("history.size"), 1); len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	h.entries[guildID] = entries
+}
+
+// returns the played tracks of the guild, most recent first
+func (h *History) Entries(guildID snowflake.ID) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries[guildID]
+	recent := make([]HistoryEntry, len(entries))
+	for i, entry := range entries {
+		recent[len(entries)-1-i] = entry
+	}
+	return recent
+}
+
+// reports whether the track was played recently in the guild
+func (h *History) Contains(guildID snowflake.ID, track lavalink.Track) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, entry := range h.entries[guildID] {
+		if trackKey(entry.Track) == trackKey(track) {
+			return true
+		}
+	}
+	return false
+}
+
+// removes the track played before the current one and the current track, both are added again once they start playing.
+// if playing is false, there is no current track and only the last played track is removed.
+// returns the removed entries oldest first, so the previous track is the first one.
+func (h *History) Previous(guildID snowflake.ID, playing bool) ([]HistoryEntry, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := h.entries[guildID]
+	take := 1
+	if playing {
+		take = 2
+	}
+	if len(entries) < take {
+		return nil, false
+	}
+
+	h.entries[guildID] = entries[:len(entries)-take]
+	return slices.Clone(entries[len(entries)-take:]), true
+}
+
+// adds entries removed by Previous back, e.g. when the previous track couldn't be played
+func (h *History) Restore(guildID snowflake.ID, entries []HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[guildID] = append(h.entries[guildID], entries...)
+}
+
+func (h CmdHandler) previous(event *handler.CommandEvent) error {
+	logger.Info("Received /previous command")
+
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No player found",
+		})
+	}
+
+	current := player.Track()
+	taken, ok := h.musicBot.History.Previous(*event.GuildID(), current != nil)
+	if !ok {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "There is no previous track",
+		})
+	}
+	previous := taken[0]
+
+	if err := player.Update(context.TODO(), lavalink.WithTrack(previous.Track)); err != nil {
+		// nothing changed, the tracks are still the previous and the current one
+		h.musicBot.History.Restore(*event.GuildID(), taken)
+		msg := "error while playing previous track"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while playing: `%s`", previous.Track.Info.Title),
+		})
+	}
+
+	// keep the current track, it's played again after the previous one
+	if current != nil {
+		h.musicBot.Queues.Get(*event.GuildID()).AddNext(*current)
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Playing previous track: %s", formatTrack(previous.Track)),
+	})
+}
+
+func (h CmdHandler) historyList(event *handler.CommandEvent) error {
+	logger.Info("Received /history list command")
+
+	entries := h.musicBot.History.Entries(*event.GuildID())
+	if len(entries) == 0 {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Nothing was played yet",
+		})
+	}
+
+	var description strings.Builder
+	for i, entry := range entries[:min(len(entries), queuePageSize*2)] {
+		fmt.Fprintf(&description, "%d. %s %s", i+1, formatTrack(entry.Track), discord.NewTimestamp(discord.TimestampStyleRelative, entry.PlayedAt))
+		if requester := formatRequester(entry.Track); requester != "" {
+			fmt.Fprintf(&description, " • %s", requester)
+		}
+		description.WriteString("\n")
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Embeds: []discord.Embed{discord.NewEmbedBuilder().
+			SetTitle("Recently played").
+			SetDescription(description.String()).
+			SetFooterText("Use /history requeue to add tracks back to the queue").
+			Build(),
+		},
+		// don't ping the requesters
+		AllowedMentions: &discord.AllowedMentions{},
+	})
+}
+
+func (h CmdHandler) historyRequeue(event *handler.CommandEvent) error {
+	logger.Info("Received /history requeue command")
+
+	voiceState, ok := h.musicBot.Client.Caches().VoiceState(*event.GuildID(), event.User().ID)
+	if !ok || voiceState.ChannelID == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "You need to be in a voice channel to use this command",
+		})
+	}
+
+	entries := h.musicBot.History.Entries(*event.GuildID())
+	from, to, err := parsePositionRange(event.SlashCommandInteractionData().String("position"))
+	if eris.Is(err, errReversedRange) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: reversedRangeMessage(from, to),
+		})
+	}
+	if err != nil || from < 1 || from > to || to > len(entries) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Position must be between `1` and `%d`, or a range like `2-5`", len(entries)),
+		})
+	}
+
+	// requeue in the order they were played
+	tracks := make([]lavalink.Track, 0, to-from+1)
+	for i := to; i >= from; i-- {
+		tracks = append(tracks, entries[i-1].Track)
+	}
+
+	// joining and starting the player can take longer than discord waits for a response
+	if err = event.DeferCreateMessage(false); err != nil {
+		return err
+	}
+
+	h.musicBot.Announcer.SetChannel(*event.GuildID(), event.ChannelID())
+	msg, err := h.enqueue(*event.GuildID(), *voiceState.ChannelID, withRequest(tracks, TrackRequest{
+		UserID:        event.User().ID,
+		ChannelID:     event.ChannelID(),
+		InteractionID: event.ID(),
+		RequestedAt:   time.Now(),
+	}))
+	if err != nil {
+		logger.Error("Failed to requeue tracks", tint.Err(eris.Wrap(err, "failed to requeue tracks")))
+	}
+
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: &msg,
+	})
+	return err
+}
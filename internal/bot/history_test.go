@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestHistoryPreviousAndRestore(t *testing.T) {
+	history := NewHistory()
+	guildID := snowflake.ID(1)
+	for _, track := range testTracks(3) {
+		history.Add(guildID, track)
+	}
+
+	taken, ok := history.Previous(guildID, true)
+	if !ok || len(taken) != 2 {
+		t.Fatalf("Previous = %d entries, %t, want 2 entries", len(taken), ok)
+	}
+	if taken[0].Track.Info.Title != "Track 1" || taken[1].Track.Info.Title != "Track 2" {
+		t.Fatalf("Previous took %s and %s, want Track 1 and Track 2", taken[0].Track.Info.Title, taken[1].Track.Info.Title)
+	}
+	if entries := history.Entries(guildID); len(entries) != 1 {
+		t.Fatalf("%d entries left, want 1", len(entries))
+	}
+
+	// playing the previous track failed
+	history.Restore(guildID, taken)
+	entries := history.Entries(guildID)
+	if len(entries) != 3 || entries[0].Track.Info.Title != "Track 2" || entries[1].Track.Info.Title != "Track 1" {
+		t.Fatalf("restored history = %+v, want Track 2, Track 1 and Track 0", entries)
+	}
+
+	if taken, ok = history.Previous(guildID, false); !ok || len(taken) != 1 || taken[0].Track.Info.Title != "Track 2" {
+		t.Errorf("Previous without current track = %+v, %t, want Track 2", taken, ok)
+	}
+	history.Previous(guildID, false)
+	if _, ok = history.Previous(guildID, true); ok {
+		t.Error("Previous with only the current track left returned a track")
+	}
+}
@@ -0,0 +1,186 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// IdleManager makes the bot leave voice channels it isn't needed in anymore.
+// It leaves after nothing was played for the idle timeout of the guild settings or idle.timeout, and pauses and then leaves after idle.alone.timeout
+// when nobody else is left in the voice channel.
+type IdleManager struct {
+	musicBot *MusicBot
+
+	mu sync.Mutex
+	// running timers of guilds where nothing is playing
+	idleTimers map[snowflake.ID]*time.Timer
+	// running timers of guilds where the bot is alone
+	aloneTimers map[snowflake.ID]*time.Timer
+	// guilds whose player was paused because the bot was alone
+	pausedAlone map[snowflake.ID]bool
+}
+
+func newIdleManager(musicBot *MusicBot) *IdleManager {
+	return &IdleManager{
+		musicBot:    musicBot,
+		idleTimers:  make(map[snowflake.ID]*time.Timer),
+		aloneTimers: make(map[snowflake.ID]*time.Timer),
+		pausedAlone: make(map[snowflake.ID]bool),
+	}
+}
+
+// starts the idle timer if the player has nothing to play anymore
+func (m *IdleManager) CheckPlaying(player disgolink.Player) {
+	if player.Track() != nil {
+		m.StopIdle(player.GuildID())
+		return
+	}
+	m.StartIdle(player.GuildID())
+}
+
+// starts the timer to leave the voice channel because nothing is playing
+func (m *IdleManager) StartIdle(guildID snowflake.ID) {
+	timeout := m.musicBot.Settings.Get(guildID).idleTimeout()
+	if timeout <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.idleTimers[guildID]; ok {
+		return
+	}
+	m.idleTimers[guildID] = time.AfterFunc(timeout, func() {
+		m.leave(guildID, "Left the voice channel because nothing was played for a while")
+	})
+}
+
+// stops the idle timer, called when music starts playing again
+func (m *IdleManager) StopIdle(guildID snowflake.ID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timer, ok := m.idleTimers[guildID]; ok {
+		timer.Stop()
+		delete(m.idleTimers, guildID)
+	}
+}
+
+// pauses the player and starts the timer to leave when the bot is alone in its voice channel,
+// or stops the timer and resumes the player when someone joined again
+func (m *IdleManager) CheckAlone(guildID snowflake.ID) {
+	voiceState, ok := m.musicBot.Client.Caches().VoiceState(guildID, m.musicBot.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		return
+	}
+
+	if len(m.musicBot.listeners(guildID, *voiceState.ChannelID)) > 0 {
+		m.stopAlone(guildID)
+		return
+	}
+	m.startAlone(guildID)
+}
+
+func (m *IdleManager) startAlone(guildID snowflake.ID) {
+	timeout := k.Duration("idle.alone.timeout")
+	if timeout <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	if _, ok := m.aloneTimers[guildID]; ok {
+		m.mu.Unlock()
+		return
+	}
+	m.aloneTimers[guildID] = time.AfterFunc(timeout, func() {
+		m.leave(guildID, "Left the voice channel because everyone else left")
+	})
+	m.mu.Unlock()
+
+	// pause until someone comes back
+	player := m.musicBot.Lavalink.ExistingPlayer(guildID)
+	if player == nil || player.Track() == nil || player.Paused() {
+		return
+	}
+	if err := m.musicBot.setPaused(context.TODO(), player, true); err != nil {
+		msg := "error while pausing player"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		return
+	}
+
+	m.mu.Lock()
+	m.pausedAlone[guildID] = true
+	m.mu.Unlock()
+}
+
+func (m *IdleManager) stopAlone(guildID snowflake.ID) {
+	m.mu.Lock()
+	if timer, ok := m.aloneTimers[guildID]; ok {
+		timer.Stop()
+		delete(m.aloneTimers, guildID)
+	}
+	paused := m.pausedAlone[guildID]
+	delete(m.pausedAlone, guildID)
+	m.mu.Unlock()
+
+	// only resume if the bot paused the player itself
+	if !paused {
+		return
+	}
+	if player := m.musicBot.Lavalink.ExistingPlayer(guildID); player != nil {
+		if err := m.musicBot.setPaused(context.TODO(), player, false); err != nil {
+			msg := "error while resuming player"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		}
+	}
+}
+
+// stops all timers of the guild, called when the bot left the voice channel
+func (m *IdleManager) Reset(guildID snowflake.ID) {
+	m.StopIdle(guildID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if timer, ok := m.aloneTimers[guildID]; ok {
+		timer.Stop()
+		delete(m.aloneTimers, guildID)
+	}
+	delete(m.pausedAlone, guildID)
+}
+
+// leaves the voice channel of the guild and tells the users why
+func (m *IdleManager) leave(guildID snowflake.ID, reason string) {
+	logger.Info("Leaving idle voice channel", slog.String("guild.id", guildID.String()), slog.String("reason", reason))
+
+	m.musicBot.Announcer.Notify(guildID, reason)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.musicBot.Client.UpdateVoiceState(ctx, guildID, nil, false, false); err != nil {
+		msg := "error while leaving voice channel"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+	}
+	m.Reset(guildID)
+}
+
+// returns the users in the voice channel, except for bots
+func (b *MusicBot) listeners(guildID snowflake.ID, channelID snowflake.ID) []snowflake.ID {
+	var userIDs []snowflake.ID
+	b.Client.Caches().VoiceStatesForEach(guildID, func(voiceState discord.VoiceState) {
+		if voiceState.ChannelID == nil || *voiceState.ChannelID != channelID || voiceState.UserID == b.Client.ApplicationID() {
+			return
+		}
+		if member, ok := b.Client.Caches().Member(guildID, voiceState.UserID); ok && member.User.Bot {
+			return
+		}
+		userIDs = append(userIDs, voiceState.UserID)
+	})
+	return userIDs
+}
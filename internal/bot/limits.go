@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// limits tracks added to a guilds queue have to stay within, zero means unlimited
+type queueLimits struct {
+	// maximum amount of tracks in the queue, including the current one
+	maxLength int
+	// maximum amount of tracks of a single user in the queue, including the current one
+	maxPerUser int
+	// maximum length of a track
+	maxDuration     lavalink.Duration
+	allowStreams    bool
+	allowDuplicates bool
+}
+
+// returns the queue limits of the guild, the guild settings take precedence over the global config
+func (b *MusicBot) queueLimits(guildID snowflake.ID) queueLimits {
+	settings := b.Settings.Get(guildID)
+
+	limits := queueLimits{
+		maxLength:       k.Int("queue.max.length"),
+		maxPerUser:      k.Int("queue.max.user"),
+		maxDuration:     lavalink.Duration(k.Duration("queue.max.duration").Milliseconds()),
+		allowStreams:    k.Bool("queue.streams"),
+		allowDuplicates: k.Bool("queue.duplicates"),
+	}
+	if settings.MaxQueueLength > 0 {
+		limits.maxLength = settings.MaxQueueLength
+	}
+	if settings.MaxTrackDuration > 0 {
+		limits.maxDuration = settings.MaxTrackDuration
+	}
+	return limits
+}
+
+// drops the tracks which would break the queue limits of the guild.
+// returns the remaining tracks and one note for every reason tracks were dropped for.
+func (b *MusicBot) limitTracks(guildID snowflake.ID, tracks []lavalink.Track) ([]lavalink.Track, []string) {
+	limits := b.queueLimits(guildID)
+
+	queued := b.Queues.Get(guildID).Tracks()
+	if player := b.Lavalink.ExistingPlayer(guildID); player != nil && player.Track() != nil {
+		queued = append(queued, *player.Track())
+	}
+
+	seen := make(map[string]bool, len(queued))
+	perUser := make(map[snowflake.ID]int)
+	for _, track := range queued {
+		seen[trackKey(track)] = true
+		if request, ok := trackRequest(track); ok {
+			perUser[request.UserID]++
+		}
+	}
+
+	var (
+		accepted                                         []lavalink.Track
+		blocked, streams, tooLong, duplicates, userLimit int
+	)
+	for _, track := range tracks {
+		switch {
+		case !b.sourceAllowed(guildID, track.Info.SourceName):
+			blocked++
+		case track.Info.IsStream && !limits.allowStreams:
+			streams++
+		case !track.Info.IsStream && limits.maxDuration > 0 && track.Info.Length > limits.maxDuration:
+			tooLong++
+		case !limits.allowDuplicates && seen[trackKey(track)]:
+			duplicates++
+		default:
+			request, ok := trackRequest(track)
+			if ok && limits.maxPerUser > 0 && perUser[request.UserID] >= limits.maxPerUser {
+				userLimit++
+				continue
+			}
+			if ok {
+				perUser[request.UserID]++
+			}
+			seen[trackKey(track)] = true
+			accepted = append(accepted, track)
+		}
+	}
+
+	var notes []string
+	if blocked > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %s from sources which aren't allowed on this server", pluralTracks(blocked)))
+	}
+	if streams > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %s because livestreams aren't allowed", pluralTracks(streams)))
+	}
+	if tooLong > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %s longer than `%s`", pluralTracks(tooLong), formatPosition(limits.maxDuration)))
+	}
+	if duplicates > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %s already in the queue", pluralTracks(duplicates)))
+	}
+	if userLimit > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %s because you may only have `%d` tracks in the queue", pluralTracks(userLimit), limits.maxPerUser))
+	}
+
+	if limits.maxLength > 0 && len(queued)+len(accepted) > limits.maxLength {
+		free := max(limits.maxLength-len(queued), 0)
+		notes = append(notes, fmt.Sprintf("Skipped %s because the queue is limited to `%d` tracks", pluralTracks(len(accepted)-free), limits.maxLength))
+		accepted = accepted[:free]
+	}
+
+	return accepted, notes
+}
+
+// identifies a track for duplicate detection
+func trackKey(track lavalink.Track) string {
+	return track.Info.SourceName + ":" + track.Info.Identifier
+}
+
+func pluralTracks(n int) string {
+	if n == 1 {
+		return "`1` track"
+	}
+	return fmt.Sprintf("`%d` tracks", n)
+}
+
+// limits how often each user may use a command within a time window
+type rateLimiter struct {
+	mu sync.Mutex
+	// times of the recent uses of each user
+	uses map[rateLimitKey][]time.Time
+	// last time users without recent uses were forgotten
+	swept time.Time
+}
+
+type rateLimitKey struct {
+	guildID snowflake.ID
+	userID  snowflake.ID
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		uses: make(map[rateLimitKey][]time.Time),
+	}
+}
+
+// records a use by the user and reports whether it's within the limit.
+// if it isn't, the returned duration is how long the user has to wait.
+func (l *rateLimiter) allow(guildID snowflake.ID, userID snowflake.ID, limit int, window time.Duration) (time.Duration, bool) {
+	if limit <= 0 || window <= 0 {
+		return 0, true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := rateLimitKey{guildID: guildID, userID: userID}
+	now := time.Now()
+
+	// forget everyone whose uses all left the window, at most once per window so allow stays cheap
+	if now.Sub(l.swept) >= window {
+		for other, uses := range l.uses {
+			if len(uses) == 0 || now.Sub(uses[len(uses)-1]) >= window {
+				delete(l.uses, other)
+			}
+		}
+		l.swept = now
+	}
+
+	// forget uses which left the window
+	uses := l.uses[key]
+	for len(uses) > 0 && now.Sub(uses[0]) >= window {
+		uses = uses[1:]
+	}
+
+	if len(uses) >= limit {
+		l.uses[key] = uses
+		return window - now.Sub(uses[0]), false
+	}
+
+	l.uses[key] = append(uses, now)
+	return 0, true
+}
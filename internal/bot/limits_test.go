@@ -0,0 +1,254 @@
+package bot
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/json"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := newRateLimiter()
+	guildID, userID := snowflake.ID(1), snowflake.ID(10)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := limiter.allow(guildID, userID, 3, time.Minute); !ok {
+			t.Fatalf("use %d was limited, want allowed", i+1)
+		}
+	}
+	wait, ok := limiter.allow(guildID, userID, 3, time.Minute)
+	if ok || wait <= 0 || wait > time.Minute {
+		t.Errorf("fourth use = %s, %v, want limited with a wait within the window", wait, ok)
+	}
+
+	// other users and guilds have their own limit
+	if _, ok = limiter.allow(guildID, 11, 3, time.Minute); !ok {
+		t.Error("other user was limited")
+	}
+	if _, ok = limiter.allow(2, userID, 3, time.Minute); !ok {
+		t.Error("other guild was limited")
+	}
+}
+
+func TestRateLimiterForgetsOldUses(t *testing.T) {
+	limiter := newRateLimiter()
+	window := 20 * time.Millisecond
+
+	for userID := snowflake.ID(1); userID <= 100; userID++ {
+		limiter.allow(1, userID, 1, window)
+	}
+	time.Sleep(2 * window)
+
+	// any later use sweeps the users whose uses left the window
+	if _, ok := limiter.allow(1, 1, 1, window); !ok {
+		t.Fatal("use after the window was limited")
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	if len(limiter.uses) != 1 {
+		t.Errorf("limiter remembers %d users, want 1", len(limiter.uses))
+	}
+}
+
+// a lavalink client whose only player is playing a track
+type fakeLavalink struct {
+	disgolink.Client
+	player disgolink.Player
+}
+
+func (l fakeLavalink) ExistingPlayer(snowflake.ID) disgolink.Player { return l.player }
+
+type fakePlayingPlayer struct {
+	disgolink.Player
+	track lavalink.Track
+}
+
+func (p fakePlayingPlayer) Track() *lavalink.Track { return &p.track }
+
+// sets the config value for the rest of the test
+func setConfig(t *testing.T, key string, value any) {
+	t.Helper()
+	previous, existed := k.Get(key), k.Exists(key)
+	if err := k.Set(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if existed {
+			_ = k.Set(key, previous)
+		} else {
+			k.Delete(key)
+		}
+	})
+}
+
+func TestLimitTracks(t *testing.T) {
+	user := func(userID snowflake.ID, tracks ...lavalink.Track) []lavalink.Track {
+		return withRequest(tracks, TrackRequest{UserID: userID})
+	}
+	withSource := func(track lavalink.Track, source string) lavalink.Track {
+		track.Info.SourceName = source
+		return track
+	}
+	stream := testTrack(5)
+	stream.Info.IsStream = true
+	long := testTrack(6)
+	long.Info.Length = 20 * lavalink.Minute
+
+	tests := []struct {
+		name     string
+		config   map[string]any
+		settings func(settings *GuildSettings)
+		current  *lavalink.Track
+		queued   []lavalink.Track
+		tracks   []lavalink.Track
+		// indexes of the accepted tracks
+		want      []int
+		wantNotes []string
+	}{
+		{
+			name:   "within limits",
+			tracks: testTracks(3),
+			want:   []int{0, 1, 2},
+		},
+		{
+			name:      "blocked source",
+			config:    map[string]any{"play.sources.blocked": "soundcloud"},
+			tracks:    []lavalink.Track{testTrack(0), withSource(testTrack(1), "soundcloud")},
+			want:      []int{0},
+			wantNotes: []string{"sources which aren't allowed"},
+		},
+		{
+			name:      "source blocked by the guild",
+			settings:  func(settings *GuildSettings) { settings.BlockedSources = []string{"soundcloud"} },
+			tracks:    []lavalink.Track{withSource(testTrack(0), "soundcloud"), testTrack(1)},
+			want:      []int{1},
+			wantNotes: []string{"sources which aren't allowed"},
+		},
+		{
+			name:      "streams",
+			config:    map[string]any{"queue.streams": false},
+			tracks:    []lavalink.Track{stream, testTrack(1)},
+			want:      []int{1},
+			wantNotes: []string{"livestreams aren't allowed"},
+		},
+		{
+			name:      "too long",
+			config:    map[string]any{"queue.max.duration": "10m"},
+			tracks:    []lavalink.Track{testTrack(0), long, stream},
+			want:      []int{0, 2},
+			wantNotes: []string{"longer than `10:00`"},
+		},
+		{
+			name:      "too long for the guild",
+			config:    map[string]any{"queue.max.duration": "1h"},
+			settings:  func(settings *GuildSettings) { settings.MaxTrackDuration = 5 * lavalink.Minute },
+			tracks:    []lavalink.Track{long},
+			wantNotes: []string{"longer than `5:00`"},
+		},
+		{
+			name:      "duplicates",
+			current:   json.Ptr(testTrack(0)),
+			queued:    []lavalink.Track{testTrack(1)},
+			tracks:    []lavalink.Track{testTrack(0), testTrack(1), testTrack(2), testTrack(2)},
+			want:      []int{2},
+			wantNotes: []string{"`3` tracks already in the queue"},
+		},
+		{
+			name:   "duplicates allowed",
+			config: map[string]any{"queue.duplicates": true},
+			queued: []lavalink.Track{testTrack(0)},
+			tracks: []lavalink.Track{testTrack(0), testTrack(0)},
+			want:   []int{0, 1},
+		},
+		{
+			name:      "per user",
+			config:    map[string]any{"queue.max.user": 2},
+			current:   json.Ptr(user(10, testTrack(0))[0]),
+			tracks:    append(user(10, testTrack(1), testTrack(2)), user(11, testTrack(3))...),
+			want:      []int{0, 2},
+			wantNotes: []string{"you may only have `2` tracks"},
+		},
+		{
+			name:      "queue length counts the current track",
+			config:    map[string]any{"queue.max.length": 3},
+			current:   json.Ptr(testTrack(0)),
+			queued:    []lavalink.Track{testTrack(1)},
+			tracks:    testTracks(5)[2:],
+			want:      []int{0},
+			wantNotes: []string{"Skipped `2` tracks because the queue is limited to `3` tracks"},
+		},
+		{
+			name:      "queue already full",
+			config:    map[string]any{"queue.max.length": 2},
+			current:   json.Ptr(testTrack(0)),
+			queued:    []lavalink.Track{testTrack(1)},
+			tracks:    testTracks(4)[2:],
+			wantNotes: []string{"Skipped `2` tracks because the queue is limited to `2` tracks"},
+		},
+		{
+			name:      "queue length of the guild",
+			config:    map[string]any{"queue.max.length": 1000},
+			settings:  func(settings *GuildSettings) { settings.MaxQueueLength = 2 },
+			queued:    []lavalink.Track{testTrack(0)},
+			tracks:    testTracks(4)[1:],
+			want:      []int{0},
+			wantNotes: []string{"limited to `2` tracks"},
+		},
+		{
+			name:      "several reasons",
+			config:    map[string]any{"queue.streams": false, "queue.max.length": 2},
+			queued:    []lavalink.Track{testTrack(0)},
+			tracks:    []lavalink.Track{stream, testTrack(0), testTrack(1), testTrack(2)},
+			want:      []int{2},
+			wantNotes: []string{"livestreams", "already in the queue", "limited to `2` tracks"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t)
+			guildID := snowflake.ID(1)
+
+			for key, value := range tt.config {
+				setConfig(t, key, value)
+			}
+			if tt.settings != nil {
+				if err := b.Settings.Update(guildID, tt.settings); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.current != nil {
+				b.Lavalink = fakeLavalink{Client: b.Lavalink, player: fakePlayingPlayer{track: *tt.current}}
+			}
+			b.Queues.Get(guildID).Add(tt.queued...)
+
+			accepted, notes := b.limitTracks(guildID, tt.tracks)
+
+			want := make([]string, 0, len(tt.want))
+			for _, i := range tt.want {
+				want = append(want, trackKey(tt.tracks[i]))
+			}
+			got := make([]string, 0, len(accepted))
+			for _, track := range accepted {
+				got = append(got, trackKey(track))
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("accepted %v, want %v", got, want)
+			}
+
+			if len(notes) != len(tt.wantNotes) {
+				t.Fatalf("notes = %q, want %d notes", notes, len(tt.wantNotes))
+			}
+			for i, note := range tt.wantNotes {
+				if !strings.Contains(notes[i], note) {
+					t.Errorf("note %d = %q, want it to contain %q", i, notes[i], note)
+				}
+			}
+		})
+	}
+}
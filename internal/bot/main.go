@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/disgoorg/disgolink/v3/lavalink"
 	"github.com/disgoorg/snowflake/v2"
 	"github.com/knadh/koanf/parsers/dotenv"
 	"github.com/knadh/koanf/providers/env"
@@ -38,14 +39,18 @@ func Start() {
 	bot, err := NewMusicBot(k.String("discord.token"))
 	if err != nil {
 		msg := "error while creating disgo client"
-		logger.Error(msg, eris.Wrap(err, msg))
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
+		os.Exit(1)
 	}
 
 	// open gateway connection
 	// and connect to lavalink
 	err = bot.Start(ctx)
 	if err != nil {
-		logger.Error("error while starting bot", err)
+		logger.Error("error while starting bot", tint.Err(err))
+		// the bot can't play anything without lavalink
+		shutdown(bot, k.Duration("shutdown.timeout"))
+		os.Exit(1)
 	}
 
 	guilds := []snowflake.ID{}
@@ -62,14 +67,47 @@ func Start() {
 	// sync commands to discord
 	err = bot.Sync(ctx, guilds)
 	if err != nil {
-		logger.Error("error while syncing guilds", err)
+		logger.Error("error while syncing guilds", tint.Err(err))
 	}
 
 	logger.Info("DisGo example is now running. Press CTRL-C to exit.")
 	s := make(chan os.Signal, 1)
 	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
-	<-s
+	sig := <-s
 
+	logger.Info("Shutting down", slog.String("signal", sig.String()))
+	os.Exit(shutdown(bot, k.Duration("shutdown.timeout")))
+}
+
+// closes the bot within the timeout and returns the exit code.
+// a second signal or the timeout running out stops waiting for the bot to close.
+func shutdown(bot *MusicBot, timeout time.Duration) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- bot.Close(ctx)
+	}()
+
+	s := make(chan os.Signal, 1)
+	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			logger.Error("error while shutting down", tint.Err(err))
+			return 1
+		}
+		logger.Info("Shut down cleanly")
+		return 0
+	case <-ctx.Done():
+		logger.Error("shutdown timed out", slog.Duration("timeout", timeout))
+		return 1
+	case <-s:
+		logger.Warn("received second signal, exiting without finishing shutdown")
+		return 130
+	}
 }
 
 func loadConfig() {
@@ -81,14 +119,14 @@ func loadConfig() {
 		enableDotEnv = false
 	} else if err != nil {
 		msg := "error while checking if .env file exists"
-		logger.Error(msg, eris.Wrap(err, msg))
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
 	}
 
 	if enableDotEnv {
 		// Load dotenv config.
 		if err := k.Load(file.Provider(".env"), dotenv.Parser()); err != nil {
 			msg := "error while loading dotenv config"
-			logger.Error(msg, eris.Wrap(err, msg))
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
 		}
 	}
 
@@ -99,7 +137,7 @@ func loadConfig() {
 		return strings.Replace(strings.ToLower(str), "_", ".", -1)
 	}), nil); err != nil {
 		msg := "error while loading environment variables"
-		logger.Error(msg, eris.Wrap(err, msg))
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
 	}
 
 	// Set default values
@@ -120,4 +158,77 @@ func setDefaultConfig() {
 	if !k.Exists("lavalink.node.password") {
 		k.Set("lavalink.node.password", "youshallnotpass")
 	}
+
+	// play stuff
+	if !k.Exists("play.search.mode") {
+		k.Set("play.search.mode", searchModeFirst)
+	}
+	if !k.Exists("play.search.results") {
+		k.Set("play.search.results", 5)
+	}
+	if !k.Exists("play.search.source") {
+		k.Set("play.search.source", string(lavalink.SearchTypeYouTube))
+	}
+
+	if !k.Exists("play.ratelimit.count") {
+		k.Set("play.ratelimit.count", 5)
+	}
+	if !k.Exists("play.ratelimit.window") {
+		k.Set("play.ratelimit.window", "30s")
+	}
+
+	// queue stuff
+	if !k.Exists("queue.max.length") {
+		k.Set("queue.max.length", 1000)
+	}
+	if !k.Exists("queue.streams") {
+		k.Set("queue.streams", true)
+	}
+	if !k.Exists("queue.duplicates") {
+		k.Set("queue.duplicates", false)
+	}
+
+	// history stuff
+	if !k.Exists("history.size") {
+		k.Set("history.size", 50)
+	}
+
+	// recovery stuff
+	if !k.Exists("recovery.alternate") {
+		k.Set("recovery.alternate", false)
+	}
+
+	// skip stuff
+	if !k.Exists("skip.mode") {
+		k.Set("skip.mode", skipModeDirect)
+	}
+	if !k.Exists("skip.vote.ratio") {
+		k.Set("skip.vote.ratio", 0.5)
+	}
+
+	// announcement stuff
+	if !k.Exists("announce.edit") {
+		k.Set("announce.edit", true)
+	}
+
+	// idle stuff
+	if !k.Exists("idle.timeout") {
+		k.Set("idle.timeout", "5m")
+	}
+	if !k.Exists("idle.alone.timeout") {
+		k.Set("idle.alone.timeout", "1m")
+	}
+
+	// storage stuff
+	if !k.Exists("storage.path") {
+		k.Set("storage.path", "data")
+	}
+	if !k.Exists("storage.interval") {
+		k.Set("storage.interval", "30s")
+	}
+
+	// shutdown stuff
+	if !k.Exists("shutdown.timeout") {
+		k.Set("shutdown.timeout", "30s")
+	}
 }
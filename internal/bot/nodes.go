@@ -0,0 +1,273 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// configuration of a single lavalink node
+type NodeConfig struct {
+	Name     string
+	Address  string
+	Password string
+	Secure   bool
+	// voice region prefix this node is close to, e.g. "rotterdam"
+	Region string
+}
+
+// loads the configured lavalink nodes.
+// lavalink.node.names holds a comma separated list of node names, each node is then
+// configured with lavalink.node.<name>.address, .password, .secure and .region.
+// if no names are set, the single lavalink.node.* node is used.
+func loadNodeConfigs() []NodeConfig {
+	if !k.Exists("lavalink.node.names") {
+		return []NodeConfig{{
+			Name:     k.String("lavalink.node.name"),
+			Address:  k.String("lavalink.node.address"),
+			Password: k.String("lavalink.node.password"),
+			Secure:   k.Bool("lavalink.node.secure"),
+			Region:   k.String("lavalink.node.region"),
+		}}
+	}
+
+	var configs []NodeConfig
+	for _, name := range strings.Split(k.String("lavalink.node.names"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		prefix := "lavalink.node." + name + "."
+
+		if !k.Exists(prefix + "address") {
+			logger.Warn("lavalink node has no address, skipping it", slog.String("node", name))
+			continue
+		}
+
+		password := k.String(prefix + "password")
+		if password == "" {
+			password = k.String("lavalink.node.password")
+		}
+
+		configs = append(configs, NodeConfig{
+			Name:     name,
+			Address:  k.String(prefix + "address"),
+			Password: password,
+			Secure:   k.Bool(prefix + "secure"),
+			Region:   k.String(prefix + "region"),
+		})
+	}
+	return configs
+}
+
+// voice server info of a guild, needed to move a player to another node
+type voiceServer struct {
+	Token    string
+	Endpoint string
+}
+
+// NodePool tracks the health of the lavalink nodes and moves players away from nodes that go down.
+// It is registered as a disgolink plugin to receive node open/close events.
+type NodePool struct {
+	musicBot *MusicBot
+
+	mu           sync.Mutex
+	configs      map[string]NodeConfig
+	healthy      map[string]bool
+	voiceServers map[snowflake.ID]voiceServer
+	closing      bool
+}
+
+func newNodePool(musicBot *MusicBot) *NodePool {
+	return &NodePool{
+		musicBot:     musicBot,
+		configs:      make(map[string]NodeConfig),
+		healthy:      make(map[string]bool),
+		voiceServers: make(map[snowflake.ID]voiceServer),
+	}
+}
+
+func (p *NodePool) Name() string {
+	return "apollo_node_pool"
+}
+
+func (p *NodePool) Version() string {
+	return "1.0.0"
+}
+
+func (p *NodePool) OnNodeOpen(node disgolink.Node) {
+	p.mu.Lock()
+	p.healthy[node.Config().Name] = true
+	p.mu.Unlock()
+
+	logger.Info("lavalink node is healthy", slog.String("node", node.Config().Name))
+}
+
+func (p *NodePool) OnNodeClose(node disgolink.Node) {
+	p.mu.Lock()
+	p.healthy[node.Config().Name] = false
+	closing := p.closing
+	p.mu.Unlock()
+
+	if closing {
+		return
+	}
+	logger.Warn("lavalink node went down, migrating players", slog.String("node", node.Config().Name))
+
+	// plugin callbacks are called while disgolink holds its plugin lock,
+	// creating players on another node needs that lock as well
+	go p.migrateFrom(node.Config().Name)
+}
+
+func (p *NodePool) OnNodeMessageIn(node disgolink.Node, data []byte) {}
+
+func (p *NodePool) OnNewPlayer(player disgolink.Player) {}
+
+func (p *NodePool) OnDestroyPlayer(player disgolink.Player) {}
+
+// registers the config of a node, so the region can be looked up later
+func (p *NodePool) addConfig(config NodeConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.configs[config.Name] = config
+}
+
+// marks the pool as closing, nodes closed after this won't trigger a migration
+func (p *NodePool) setClosing() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closing = true
+}
+
+func (p *NodePool) isHealthy(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.healthy[name]
+}
+
+func (p *NodePool) setVoiceServer(guildID snowflake.ID, token string, endpoint string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.voiceServers[guildID] = voiceServer{Token: token, Endpoint: endpoint}
+}
+
+func (p *NodePool) voiceServer(guildID snowflake.ID) (voiceServer, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	server, ok := p.voiceServers[guildID]
+	return server, ok
+}
+
+func (p *NodePool) deleteVoiceServer(guildID snowflake.ID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.voiceServers, guildID)
+}
+
+// returns the best healthy node, preferring nodes in the same region as the guilds voice server.
+// exclude can be used to skip a node which is known to be down.
+func (p *NodePool) BestNode(guildID snowflake.ID, exclude string) disgolink.Node {
+	endpoint := ""
+	if server, ok := p.voiceServer(guildID); ok {
+		endpoint = server.Endpoint
+	}
+
+	var best, bestInRegion disgolink.Node
+	p.musicBot.Lavalink.ForNodes(func(node disgolink.Node) {
+		name := node.Config().Name
+		if name == exclude || node.Status() != disgolink.StatusConnected || !p.isHealthy(name) {
+			return
+		}
+
+		if best == nil || node.Stats().Better(best.Stats()) {
+			best = node
+		}
+
+		p.mu.Lock()
+		region := p.configs[name].Region
+		p.mu.Unlock()
+		if region != "" && strings.HasPrefix(endpoint, region) {
+			if bestInRegion == nil || node.Stats().Better(bestInRegion.Stats()) {
+				bestInRegion = node
+			}
+		}
+	})
+
+	if bestInRegion != nil {
+		return bestInRegion
+	}
+	return best
+}
+
+// moves all players of the given node to the best healthy node
+func (p *NodePool) migrateFrom(nodeName string) {
+	var players []disgolink.Player
+	p.musicBot.Lavalink.ForPlayers(func(player disgolink.Player) {
+		if player.Node() != nil && player.Node().Config().Name == nodeName {
+			players = append(players, player)
+		}
+	})
+
+	for _, player := range players {
+		node := p.BestNode(player.GuildID(), nodeName)
+		if node == nil {
+			logger.Error("no healthy lavalink node left to migrate player to", slog.String("guild.id", player.GuildID().String()))
+			return
+		}
+
+		if err := p.migrate(player, node); err != nil {
+			msg := "error while migrating player"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", player.GuildID().String()))
+			continue
+		}
+		logger.Info("migrated player", slog.String("guild.id", player.GuildID().String()), slog.String("from", nodeName), slog.String("to", node.Config().Name))
+	}
+}
+
+// recreates the player on the given node and restores its voice connection and playback state.
+// the queue is kept by the QueueManager and doesn't need to be moved.
+func (p *NodePool) migrate(old disgolink.Player, node disgolink.Node) error {
+	guildID := old.GuildID()
+
+	voiceState, ok := p.musicBot.Client.Caches().VoiceState(guildID, p.musicBot.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		return eris.New("bot is not connected to a voice channel")
+	}
+	server, ok := p.voiceServer(guildID)
+	if !ok {
+		return eris.New("no voice server known for guild")
+	}
+
+	track := old.Track()
+	position := old.Position()
+	paused := old.Paused()
+	volume := old.Volume()
+	filters := old.Filters()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p.musicBot.Lavalink.RemovePlayer(guildID)
+	player := p.musicBot.Lavalink.PlayerOnNode(node, guildID)
+	player.OnVoiceStateUpdate(ctx, voiceState.ChannelID, voiceState.SessionID)
+	player.OnVoiceServerUpdate(ctx, server.Token, server.Endpoint)
+
+	opts := []lavalink.PlayerUpdateOpt{
+		lavalink.WithVolume(volume),
+		lavalink.WithPaused(paused),
+		lavalink.WithFilters(filters),
+	}
+	if track != nil {
+		opts = append(opts, lavalink.WithTrack(*track), lavalink.WithPosition(position))
+	}
+
+	return player.Update(ctx, opts...)
+}
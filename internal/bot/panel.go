@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/json"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// volume change of the volume buttons
+const panelVolumeStep = 10
+
+// order the loop button cycles through
+var nextQueueType = map[QueueType]QueueType{
+	QueueTypeNormal:      QueueTypeRepeatTrack,
+	QueueTypeRepeatTrack: QueueTypeRepeatQueue,
+	QueueTypeRepeatQueue: QueueTypeNormal,
+}
+
+// pauses or resumes the player.
+// disgolink doesn't pass its pause events on to listeners, so they are emitted here to keep the panel up to date.
+func (b *MusicBot) setPaused(ctx context.Context, player disgolink.Player, paused bool) error {
+	if player.Paused() == paused {
+		return nil
+	}
+	if err := player.Update(ctx, lavalink.WithPaused(paused)); err != nil {
+		return err
+	}
+
+	if paused {
+		b.Lavalink.EmitEvent(player, lavalink.PlayerPauseEvent{GuildID_: player.GuildID()})
+	} else {
+		b.Lavalink.EmitEvent(player, lavalink.PlayerResumeEvent{GuildID_: player.GuildID()})
+	}
+	return nil
+}
+
+// builds the now playing embed and control buttons of the guild.
+// track is the track to show, if nil the track of the player is used.
+func (b *MusicBot) nowPlayingPanel(guildID snowflake.ID, track *lavalink.Track) (discord.Embed, []discord.ContainerComponent) {
+	player := b.Lavalink.ExistingPlayer(guildID)
+	if track == nil && player != nil {
+		track = player.Track()
+	}
+	if track == nil {
+		embed := discord.NewEmbedBuilder().
+			SetAuthorName("Now playing").
+			SetDescription("Nothing is playing").
+			Build()
+		return embed, []discord.ContainerComponent{}
+	}
+
+	status, volume, paused := "Playing", 100, false
+	if player != nil {
+		volume, paused = player.Volume(), player.Paused()
+		if paused {
+			status = "Paused"
+		}
+	}
+
+	builder := discord.NewEmbedBuilder().
+		SetAuthorName("Now playing").
+		SetTitle(track.Info.Title).
+		AddField("Author", track.Info.Author, true).
+		AddField("Duration", formatTrackLength(*track), true).
+		AddField("Status", status, true).
+		AddField("Volume", fmt.Sprintf("%d%%", volume), true).
+		AddField("Loop", b.Queues.Get(guildID).Type().String(), true)
+
+	if track.Info.URI != nil {
+		builder.SetURL(*track.Info.URI)
+	}
+	if track.Info.ArtworkURL != nil {
+		builder.SetThumbnail(*track.Info.ArtworkURL)
+	}
+	if requester := formatRequester(*track); requester != "" {
+		builder.AddField("Requested by", requester, true)
+	}
+
+	pauseLabel := "Pause"
+	if paused {
+		pauseLabel = "Resume"
+	}
+
+	controls := []discord.InteractiveComponent{
+		discord.NewPrimaryButton(pauseLabel, "/player/pause"),
+		discord.NewSecondaryButton("Skip", "/player/skip"),
+	}
+	if voteSkipEnabled() {
+		controls = append(controls, discord.NewSecondaryButton("Vote skip", "/player/voteskip"))
+	}
+	controls = append(controls, discord.NewDangerButton("Stop", "/player/stop"))
+
+	components := []discord.ContainerComponent{
+		discord.NewActionRow(controls...),
+		discord.NewActionRow(
+			discord.NewSecondaryButton("Shuffle", "/player/shuffle"),
+			discord.NewSecondaryButton("Loop", "/player/loop"),
+			discord.NewSecondaryButton("Volume -", "/player/volume/down"),
+			discord.NewSecondaryButton("Volume +", "/player/volume/up"),
+		),
+	}
+
+	return builder.Build(), components
+}
+
+// responds to a panel button by redrawing the panel
+func (h CmdHandler) updatePanel(event *handler.ComponentEvent) error {
+	embed, components := h.musicBot.nowPlayingPanel(*event.GuildID(), nil)
+	return event.UpdateMessage(discord.MessageUpdate{
+		Embeds:     &[]discord.Embed{embed},
+		Components: &components,
+	})
+}
+
+// tells the user that a panel button failed, without touching the panel
+func panelError(event *handler.ComponentEvent, content string) error {
+	return event.CreateMessage(discord.MessageCreate{
+		Content: content,
+		Flags:   discord.MessageFlagEphemeral,
+	})
+}
+
+func (h CmdHandler) panelPause(event *handler.ComponentEvent) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return panelError(event, "No player found")
+	}
+
+	if err := h.musicBot.setPaused(context.TODO(), player, !player.Paused()); err != nil {
+		return panelError(event, fmt.Sprintf("Error while pausing: `%s`", err))
+	}
+	return h.updatePanel(event)
+}
+
+func (h CmdHandler) panelSkip(event *handler.ComponentEvent) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return panelError(event, "No player found")
+	}
+
+	// users may skip their own tracks, everything else needs a DJ
+	if track := player.Track(); track != nil && !h.musicBot.Permissions.CanSkip(*event.GuildID(), *event.Member(), *track) {
+		if voteSkipEnabled() {
+			return h.panelVoteSkip(event)
+		}
+		return panelError(event, "Only DJs can skip tracks requested by others")
+	}
+
+	_, ok, err := h.musicBot.Queues.Get(*event.GuildID()).NextAndPlay(func(track lavalink.Track) error {
+		return player.Update(context.TODO(), lavalink.WithTrack(track))
+	})
+	if !ok && !h.musicBot.Autoplay.SkipToRelated(player) {
+		return panelError(event, "No tracks in queue")
+	}
+	if err != nil {
+		return panelError(event, fmt.Sprintf("Error while skipping track: `%s`", err))
+	}
+
+	// the panel is redrawn once the next track starts
+	return event.DeferUpdateMessage()
+}
+
+func (h CmdHandler) panelStop(event *handler.ComponentEvent) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return panelError(event, "No player found")
+	}
+
+	if err := player.Update(context.TODO(), lavalink.WithNullTrack()); err != nil {
+		return panelError(event, fmt.Sprintf("Error while stopping: `%s`", err))
+	}
+	return h.updatePanel(event)
+}
+
+func (h CmdHandler) panelShuffle(event *handler.ComponentEvent) error {
+	h.musicBot.Queues.Get(*event.GuildID()).Shuffle()
+
+	if err := h.updatePanel(event); err != nil {
+		return err
+	}
+	_, err := event.CreateFollowupMessage(discord.MessageCreate{
+		Content: "Queue shuffled",
+		Flags:   discord.MessageFlagEphemeral,
+	})
+	return err
+}
+
+func (h CmdHandler) panelLoop(event *handler.ComponentEvent) error {
+	queue := h.musicBot.Queues.Get(*event.GuildID())
+	queue.SetType(nextQueueType[queue.Type()])
+	return h.updatePanel(event)
+}
+
+func (h CmdHandler) panelVolume(event *handler.ComponentEvent) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return panelError(event, "No player found")
+	}
+
+	volume := player.Volume()
+	if event.Variables["direction"] == "up" {
+		volume += panelVolumeStep
+	} else {
+		volume -= panelVolumeStep
+	}
+	volume = min(max(volume, 0), 1000)
+
+	if err := player.Update(context.TODO(), lavalink.WithVolume(volume)); err != nil {
+		return panelError(event, fmt.Sprintf("Error while setting volume: `%s`", err))
+	}
+	return h.updatePanel(event)
+}
+
+// content of a panel message
+func panelMessage(embed discord.Embed, components []discord.ContainerComponent) discord.MessageUpdate {
+	return discord.MessageUpdate{
+		Content:    json.Ptr(""),
+		Embeds:     &[]discord.Embed{embed},
+		Components: &components,
+	}
+}
@@ -0,0 +1,292 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// permission level needed to use a command or component
+type permission int
+
+const (
+	// anyone may use it
+	permissionAnyone permission = iota
+	// users must be in the voice channel of the bot, or in any voice channel if the bot isn't connected.
+	// handlers may check for DJs themselves, e.g. to let users skip their own tracks.
+	permissionListener
+	// users must be in the voice channel of the bot and be a DJ
+	permissionDJ
+	// permissionDJ for commands changing the current track. In vote mode a guild without DJ role
+	// doesn't make everyone a DJ, users vote to skip instead.
+	permissionTrackDJ
+	// users must be allowed to manage the guild
+	permissionManager
+)
+
+// permissions of commands and components, looked up by the longest matching path prefix
+var pathPermissions = map[string]permission{
+	"/play":            permissionListener,
+	"/now-playing":     permissionAnyone,
+	"/queue":           permissionAnyone,
+	"/queue/import":    permissionListener,
+	"/pause":           permissionListener,
+	"/skip":            permissionListener,
+	"/remove":          permissionListener,
+	"/seek":            permissionListener,
+	"/forward":         permissionListener,
+	"/rewind":          permissionListener,
+	"/stop":            permissionTrackDJ,
+	"/disconnect":      permissionDJ,
+	"/volume":          permissionDJ,
+	"/shuffle":         permissionDJ,
+	"/skipto":          permissionTrackDJ,
+	"/jump":            permissionTrackDJ,
+	"/move":            permissionDJ,
+	"/clear":           permissionDJ,
+	"/loop":            permissionDJ,
+	"/filter":          permissionDJ,
+	"/announce":        permissionDJ,
+	"/autoplay":        permissionDJ,
+	"/previous":        permissionTrackDJ,
+	"/history":         permissionAnyone,
+	"/history/requeue": permissionListener,
+	"/dj":              permissionManager,
+	"/settings":        permissionManager,
+	// changing guild playlists is checked by the handlers
+	"/playlist":      permissionAnyone,
+	"/playlist/play": permissionListener,
+
+	"/play/pick":       permissionListener,
+	"/queue/page":      permissionAnyone,
+	"/player/pause":    permissionListener,
+	"/player/skip":     permissionListener,
+	"/player/voteskip": permissionListener,
+	"/player/stop":     permissionTrackDJ,
+	"/player/shuffle":  permissionDJ,
+	"/player/loop":     permissionDJ,
+	"/player/volume":   permissionDJ,
+}
+
+// returns the permission needed for the path, paths without an entry need a DJ
+func pathPermission(path string) permission {
+	parts := splitPath(path)
+	for i := len(parts); i > 0; i-- {
+		if p, ok := pathPermissions["/"+strings.Join(parts[:i], "/")]; ok {
+			return p
+		}
+	}
+	return permissionDJ
+}
+
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// Permissions decides who may use which command, based on the DJ role in the guild settings
+type Permissions struct {
+	musicBot *MusicBot
+}
+
+func newPermissions(musicBot *MusicBot) *Permissions {
+	return &Permissions{
+		musicBot: musicBot,
+	}
+}
+
+func (p *Permissions) SetDJRole(guildID snowflake.ID, roleID snowflake.ID) error {
+	return p.musicBot.Settings.Update(guildID, func(settings *GuildSettings) {
+		settings.DJRoleID = roleID
+	})
+}
+
+func (p *Permissions) ClearDJRole(guildID snowflake.ID) error {
+	return p.musicBot.Settings.Update(guildID, func(settings *GuildSettings) {
+		settings.DJRoleID = 0
+	})
+}
+
+func (p *Permissions) DJRole(guildID snowflake.ID) (snowflake.ID, bool) {
+	roleID := p.musicBot.Settings.Get(guildID).DJRoleID
+	return roleID, roleID != 0
+}
+
+// reports whether the member may control the player of the guild.
+// Everyone is a DJ if the guild has no DJ role, otherwise members with the role,
+// members who can manage the guild and members who are alone with the bot are.
+func (p *Permissions) IsDJ(guildID snowflake.ID, member discord.ResolvedMember) bool {
+	return p.isDJ(guildID, member, true)
+}
+
+// IsDJ, but without a DJ role everyone is a DJ only if noRoleIsDJ is set
+func (p *Permissions) isDJ(guildID snowflake.ID, member discord.ResolvedMember, noRoleIsDJ bool) bool {
+	roleID, ok := p.DJRole(guildID)
+	if !ok && noRoleIsDJ {
+		return true
+	}
+	if isManager(member) {
+		return true
+	}
+	for _, id := range member.RoleIDs {
+		if ok && id == roleID {
+			return true
+		}
+	}
+
+	voiceState, ok := p.musicBot.Client.Caches().VoiceState(guildID, p.musicBot.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		return false
+	}
+	listeners := p.musicBot.listeners(guildID, *voiceState.ChannelID)
+	return len(listeners) == 1 && listeners[0] == member.User.ID
+}
+
+func isManager(member discord.ResolvedMember) bool {
+	return member.Permissions.Has(discord.PermissionManageGuild) || member.Permissions.Has(discord.PermissionAdministrator)
+}
+
+// reports whether the user is in the voice channel of the bot.
+// If the bot isn't connected, any voice channel will do.
+func (p *Permissions) InBotChannel(guildID snowflake.ID, userID snowflake.ID) bool {
+	userState, ok := p.musicBot.Client.Caches().VoiceState(guildID, userID)
+	if !ok || userState.ChannelID == nil {
+		return false
+	}
+
+	botState, ok := p.musicBot.Client.Caches().VoiceState(guildID, p.musicBot.Client.ApplicationID())
+	if !ok || botState.ChannelID == nil {
+		return true
+	}
+	return *botState.ChannelID == *userState.ChannelID
+}
+
+// Middleware checks the permissions of every command and component before its handler runs
+func (p *Permissions) Middleware(next handler.Handler) handler.Handler {
+	return func(event *events.InteractionCreate) error {
+		var path string
+		switch i := event.Interaction.(type) {
+		case discord.ApplicationCommandInteraction:
+			if data, ok := i.Data.(discord.SlashCommandInteractionData); ok {
+				path = data.CommandPath()
+			} else {
+				path = "/" + i.Data.CommandName()
+			}
+		case discord.ComponentInteraction:
+			path = i.Data.CustomID()
+		default:
+			return next(event)
+		}
+
+		member := event.Member()
+		if event.GuildID() == nil || member == nil {
+			return deny(event, "Commands can only be used in servers")
+		}
+		guildID := *event.GuildID()
+
+		switch pathPermission(path) {
+		case permissionListener:
+			if !p.InBotChannel(guildID, member.User.ID) {
+				return deny(event, "You need to be in the same voice channel as the bot to use this")
+			}
+		case permissionDJ:
+			if !p.InBotChannel(guildID, member.User.ID) {
+				return deny(event, "You need to be in the same voice channel as the bot to use this")
+			}
+			if !p.IsDJ(guildID, *member) {
+				return deny(event, "Only DJs can use this")
+			}
+		case permissionTrackDJ:
+			if !p.InBotChannel(guildID, member.User.ID) {
+				return deny(event, "You need to be in the same voice channel as the bot to use this")
+			}
+			if !p.CanChangeTrack(guildID, *member) {
+				if voteSkipEnabled() {
+					return deny(event, "Only DJs can use this, vote with `/skip` to skip the track")
+				}
+				return deny(event, "Only DJs can use this")
+			}
+		case permissionManager:
+			if !isManager(*member) {
+				return deny(event, "You need the Manage Server permission to use this")
+			}
+		}
+
+		return next(event)
+	}
+}
+
+// tells the user they aren't allowed to use the interaction
+func deny(event *events.InteractionCreate, content string) error {
+	return event.Respond(discord.InteractionResponseTypeCreateMessage, discord.MessageCreate{
+		Content: content,
+		Flags:   discord.MessageFlagEphemeral,
+	})
+}
+
+func (h CmdHandler) djSet(event *handler.CommandEvent) error {
+	logger.Info("Received /dj set command")
+
+	role := event.SlashCommandInteractionData().Role("role")
+	if err := h.musicBot.Permissions.SetDJRole(*event.GuildID(), role.ID); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while saving DJ role: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content:         "DJ role set to " + role.Mention(),
+		AllowedMentions: &discord.AllowedMentions{},
+	})
+}
+
+func (h CmdHandler) djClear(event *handler.CommandEvent) error {
+	logger.Info("Received /dj clear command")
+
+	if err := h.musicBot.Permissions.ClearDJRole(*event.GuildID()); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while clearing DJ role: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: "DJ role cleared, everyone can control the player now",
+	})
+}
+
+// reports whether the member may skip the tracks without voting.
+// In vote mode a guild without DJ role doesn't make everyone a DJ, otherwise nobody would ever vote.
+// Requesters, members who can manage the guild and members alone with the bot still skip directly.
+func (p *Permissions) CanSkip(guildID snowflake.ID, member discord.ResolvedMember, tracks ...lavalink.Track) bool {
+	if !voteSkipEnabled() {
+		return p.CanManageTracks(guildID, member, tracks...)
+	}
+	for _, track := range tracks {
+		request, ok := trackRequest(track)
+		if !ok || request.UserID != member.User.ID {
+			return p.CanChangeTrack(guildID, member)
+		}
+	}
+	return true
+}
+
+// reports whether the member may change the current track of the guild without voting, e.g. by stopping it.
+// Like IsDJ, but in vote mode a guild without DJ role doesn't make everyone a DJ.
+func (p *Permissions) CanChangeTrack(guildID snowflake.ID, member discord.ResolvedMember) bool {
+	return p.isDJ(guildID, member, !voteSkipEnabled())
+}
+
+// reports whether the member requested all of the tracks or is a DJ
+func (p *Permissions) CanManageTracks(guildID snowflake.ID, member discord.ResolvedMember, tracks ...lavalink.Track) bool {
+	for _, track := range tracks {
+		request, ok := trackRequest(track)
+		if !ok || request.UserID != member.User.ID {
+			return p.IsDJ(guildID, member)
+		}
+	}
+	return true
+}
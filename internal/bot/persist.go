@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// builds the persisted state of a guilds queue and player.
+// returns false if the bot isn't connected to a voice channel in the guild.
+func (b *MusicBot) queueState(guildID snowflake.ID) (QueueState, bool) {
+	voiceState, ok := b.Client.Caches().VoiceState(guildID, b.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		return QueueState{}, false
+	}
+
+	queue := b.Queues.Get(guildID)
+	state := QueueState{
+		GuildID:   guildID,
+		ChannelID: *voiceState.ChannelID,
+		Type:      queue.Type(),
+		Tracks:    queue.Tracks(),
+		Volume:    100,
+	}
+
+	if channelID, ok := b.Announcer.Channel(guildID); ok {
+		state.AnnounceChannelID = channelID
+	}
+
+	if player := b.Lavalink.ExistingPlayer(guildID); player != nil {
+		state.Current = player.Track()
+		state.Position = player.Position()
+		state.Paused = player.Paused()
+		state.Volume = player.Volume()
+	}
+
+	return state, true
+}
+
+// persists the queues of all guilds the bot is playing in
+func (b *MusicBot) SaveQueues(ctx context.Context) {
+	for _, guildID := range b.Queues.GuildIDs() {
+		state, ok := b.queueState(guildID)
+		if !ok {
+			continue
+		}
+
+		if err := b.Store.Save(ctx, state); err != nil {
+			msg := "error while saving queue"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		}
+	}
+}
+
+// periodically persists all queues until the bot is closed
+func (b *MusicBot) saveQueuesLoop(interval time.Duration) {
+	if interval <= 0 {
+		logger.Warn("storage.interval is not a valid duration, queues are only saved on shutdown")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			b.SaveQueues(ctx)
+			cancel()
+		}
+	}
+}
+
+// restores all persisted queues, rejoins their voice channels and resumes playback
+func (b *MusicBot) RestoreQueues(ctx context.Context) error {
+	states, err := b.Store.LoadAll(ctx)
+	if err != nil {
+		return eris.Wrap(err, "error while loading queues")
+	}
+
+	for _, state := range states {
+		if err = b.restoreQueue(ctx, state); err != nil {
+			msg := "error while restoring queue"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", state.GuildID.String()))
+			continue
+		}
+		logger.Info("Restored queue", slog.String("guild.id", state.GuildID.String()), slog.Int("tracks", len(state.Tracks)))
+	}
+
+	return nil
+}
+
+func (b *MusicBot) restoreQueue(ctx context.Context, state QueueState) error {
+	if state.AnnounceChannelID != 0 {
+		b.Announcer.SetChannel(state.GuildID, state.AnnounceChannelID)
+	}
+
+	queue := b.Queues.Get(state.GuildID)
+	queue.SetType(state.Type)
+	queue.Add(state.Tracks...)
+
+	// create the player on a healthy node before joining
+	player := b.Player(state.GuildID)
+
+	if err := b.Client.UpdateVoiceState(ctx, state.GuildID, &state.ChannelID, false, false); err != nil {
+		return eris.Wrap(err, "error while joining voice channel")
+	}
+
+	opts := []lavalink.PlayerUpdateOpt{
+		lavalink.WithVolume(state.Volume),
+		lavalink.WithPaused(state.Paused),
+	}
+	if state.Current != nil {
+		opts = append(opts, lavalink.WithTrack(*state.Current), lavalink.WithPosition(state.Position))
+	} else if track, ok := queue.Next(); ok {
+		opts = append(opts, lavalink.WithTrack(track))
+	}
+
+	if err := player.Update(ctx, opts...); err != nil {
+		return eris.Wrap(err, "error while resuming playback")
+	}
+	return nil
+}
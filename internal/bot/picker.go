@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/json"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// play the first search result
+	searchModeFirst = "first"
+	// let the user pick a search result from a select menu
+	searchModePicker = "picker"
+)
+
+// how long search results can be picked from
+const searchPickTimeout = 2 * time.Minute
+
+// search results waiting for the user to pick one
+type searchPick struct {
+	userID    snowflake.ID
+	channelID snowflake.ID
+	tracks    []lavalink.Track
+	request   TrackRequest
+}
+
+// holds the pending search results, keyed by the id of the /play interaction
+type searchPicks struct {
+	mu    sync.Mutex
+	picks map[snowflake.ID]searchPick
+}
+
+func newSearchPicks() *searchPicks {
+	return &searchPicks{
+		picks: make(map[snowflake.ID]searchPick),
+	}
+}
+
+// stores the search results until they are picked or time out
+func (s *searchPicks) add(id snowflake.ID, pick searchPick) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.picks[id] = pick
+
+	time.AfterFunc(searchPickTimeout, func() {
+		s.take(id)
+	})
+}
+
+// removes and returns the search results if the user searched for them, in one step so they can only be picked once.
+// found is false if they expired or were picked already, owner is false if another user searched.
+func (s *searchPicks) takeFor(id snowflake.ID, userID snowflake.ID) (pick searchPick, found bool, owner bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pick, found = s.picks[id]
+	if !found || pick.userID != userID {
+		return searchPick{}, found, false
+	}
+	delete(s.picks, id)
+	return pick, true, true
+}
+
+// removes and returns the search results
+func (s *searchPicks) take(id snowflake.ID) (searchPick, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pick, ok := s.picks[id]
+	delete(s.picks, id)
+	return pick, ok
+}
+
+// shows a select menu with the top search results, the picked track is played in channelID
+func (h CmdHandler) showSearchPicker(event *handler.CommandEvent, channelID snowflake.ID, tracks []lavalink.Track) error {
+	// select menus can hold at most 25 options
+	limit := min(max(k.Int("play.search.results"), 1), 25)
+	if len(tracks) > limit {
+		tracks = tracks[:limit]
+	}
+
+	options := make([]discord.StringSelectMenuOption, 0, len(tracks))
+	for i, track := range tracks {
+		options = append(options, discord.NewStringSelectMenuOption(
+			truncate(fmt.Sprintf("%d. %s", i+1, track.Info.Title), 100),
+			strconv.Itoa(i),
+		).WithDescription(truncate(fmt.Sprintf("%s - %s", track.Info.Author, formatPosition(track.Info.Length)), 100)))
+	}
+
+	h.musicBot.searchPicks.add(event.ID(), searchPick{
+		userID:    event.User().ID,
+		channelID: channelID,
+		tracks:    tracks,
+		request: TrackRequest{
+			UserID:        event.User().ID,
+			ChannelID:     event.ChannelID(),
+			InteractionID: event.ID(),
+			RequestedAt:   time.Now(),
+		},
+	})
+
+	_, err := h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: json.Ptr("Pick a track to play:"),
+		Components: &[]discord.ContainerComponent{
+			discord.NewActionRow(discord.NewStringSelectMenu(
+				fmt.Sprintf("/play/pick/%s", event.ID()),
+				"Select a track",
+				options...,
+			)),
+		},
+	})
+	return err
+}
+
+// plays the search result the user picked
+func (h CmdHandler) pickSearchResult(event *handler.ComponentEvent) error {
+	logger.Info("Received search result pick")
+
+	id, err := snowflake.Parse(event.Variables["id"])
+	if err != nil {
+		return eris.Wrap(err, "error while parsing search id")
+	}
+
+	// only the user who searched may pick
+	pick, found, owner := h.musicBot.searchPicks.takeFor(id, event.User().ID)
+	if !found {
+		return event.UpdateMessage(discord.MessageUpdate{
+			Content:    json.Ptr("These search results have expired, please search again"),
+			Components: &[]discord.ContainerComponent{},
+		})
+	}
+	if !owner {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Only the user who searched can pick a track",
+			Flags:   discord.MessageFlagEphemeral,
+		})
+	}
+
+	index, err := strconv.Atoi(event.StringSelectMenuInteractionData().Values[0])
+	if err != nil || index < 0 || index >= len(pick.tracks) {
+		return eris.New("invalid search result picked")
+	}
+
+	// joining and starting the player can take longer than discord waits for a response
+	if err = event.DeferUpdateMessage(); err != nil {
+		return err
+	}
+
+	msg, err := h.enqueue(*event.GuildID(), pick.channelID, withRequest(pick.tracks[index:index+1], pick.request))
+	if err != nil {
+		logger.Error("Failed to play track", tint.Err(eris.Wrap(err, "failed to play track")))
+	}
+
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content:    &msg,
+		Components: &[]discord.ContainerComponent{},
+	})
+	return err
+}
+
+// shortens s to at most length runes
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length-3]) + "..."
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestSearchPicksTakeFor(t *testing.T) {
+	picks := newSearchPicks()
+	id, owner, other := snowflake.ID(1), snowflake.ID(10), snowflake.ID(11)
+	picks.add(id, searchPick{userID: owner, tracks: testTracks(3)})
+
+	if _, found, isOwner := picks.takeFor(id, other); !found || isOwner {
+		t.Fatalf("takeFor other user = found %v, owner %v, want found by another user", found, isOwner)
+	}
+	// another user trying doesn't remove the results
+	pick, found, isOwner := picks.takeFor(id, owner)
+	if !found || !isOwner || len(pick.tracks) != 3 {
+		t.Fatalf("takeFor owner = %+v, found %v, owner %v, want the results", pick, found, isOwner)
+	}
+	if _, found, _ = picks.takeFor(id, owner); found {
+		t.Error("results can be picked twice")
+	}
+}
+
+func TestSearchPicksConcurrentTakeFor(t *testing.T) {
+	picks := newSearchPicks()
+	id, owner := snowflake.ID(1), snowflake.ID(10)
+	picks.add(id, searchPick{userID: owner, tracks: testTracks(3)})
+
+	// double clicks and quick selections only pick once
+	var (
+		taken atomic.Int64
+		wg    sync.WaitGroup
+	)
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, found, isOwner := picks.takeFor(id, owner); found && isOwner {
+				taken.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken.Load() != 1 {
+		t.Errorf("results were picked %d times, want 1", taken.Load())
+	}
+}
@@ -0,0 +1,620 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/json"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// playlists only the user who created them can see and change
+	playlistScopeUser = "user"
+	// playlists shared by everyone in a guild, only DJs can change them
+	playlistScopeGuild = "guild"
+)
+
+const (
+	// maximum amount of playlists a user or guild can have
+	maxPlaylists = 25
+	// maximum amount of tracks in a playlist
+	maxPlaylistTracks = 1000
+)
+
+// option picking whether a playlist command is about the users or the guilds playlists
+var playlistScopeOption = discord.ApplicationCommandOptionString{
+	Name:        "scope",
+	Description: "Whether to use your playlists or the playlists of this server, defaults to yours",
+	Choices: []discord.ApplicationCommandOptionChoiceString{
+		{Name: "Yours", Value: playlistScopeUser},
+		{Name: "Server", Value: playlistScopeGuild},
+	},
+}
+
+// the user or guild a playlist belongs to
+type PlaylistOwner struct {
+	Scope string       `json:"scope"`
+	ID    snowflake.ID `json:"id"`
+}
+
+func (o PlaylistOwner) String() string {
+	return o.Scope + "-" + o.ID.String()
+}
+
+// a track saved in a playlist
+type PlaylistTrack struct {
+	// encoded lavalink track, decoded again when the playlist is played
+	Encoded string            `json:"encoded"`
+	Title   string            `json:"title"`
+	URI     *string           `json:"uri,omitempty"`
+	Length  lavalink.Duration `json:"length"`
+}
+
+func newPlaylistTrack(track lavalink.Track) PlaylistTrack {
+	return PlaylistTrack{
+		Encoded: track.Encoded,
+		Title:   track.Info.Title,
+		URI:     track.Info.URI,
+		Length:  track.Info.Length,
+	}
+}
+
+type Playlist struct {
+	Name      string          `json:"name"`
+	Owner     PlaylistOwner   `json:"owner"`
+	Tracks    []PlaylistTrack `json:"tracks"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+var (
+	errPlaylistNotFound = eris.New("playlist not found")
+	errPlaylistExists   = eris.New("playlist already exists")
+	errTooManyPlaylists = eris.New("too many playlists")
+	errInvalidPosition  = eris.New("position is outside of the playlist")
+)
+
+// PlaylistStore persists the playlists of users and guilds
+type PlaylistStore interface {
+	// loads all playlists of the owner
+	List(ctx context.Context, owner PlaylistOwner) ([]Playlist, error)
+	// saves a new playlist. fails with errPlaylistExists if the owner has a playlist with the same name already,
+	// or with errTooManyPlaylists if the owner has maxPlaylists playlists.
+	Create(ctx context.Context, playlist Playlist) error
+	// changes the playlist of the owner with the given name and saves it, nothing is saved if update fails.
+	// fails with errPlaylistNotFound if there is no such playlist, or with errPlaylistExists if it was
+	// renamed to the name of another playlist.
+	Update(ctx context.Context, owner PlaylistOwner, name string, update func(playlist *Playlist) error) error
+	// deletes the playlist of the owner with the given name
+	Delete(ctx context.Context, owner PlaylistOwner, name string) error
+}
+
+// FilePlaylistStore stores the playlists of every owner as a json file in a directory
+type FilePlaylistStore struct {
+	files fileStore
+	// guards read-modify-write cycles of the files
+	mu sync.Mutex
+}
+
+func NewFilePlaylistStore(dir string) *FilePlaylistStore {
+	return &FilePlaylistStore{
+		files: fileStore{dir: dir},
+	}
+}
+
+func (s *FilePlaylistStore) List(_ context.Context, owner PlaylistOwner) ([]Playlist, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(owner)
+}
+
+func (s *FilePlaylistStore) list(owner PlaylistOwner) ([]Playlist, error) {
+	var playlists []Playlist
+	if err := s.files.read(owner.String(), &playlists); err != nil && !eris.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return playlists, nil
+}
+
+func (s *FilePlaylistStore) Create(_ context.Context, playlist Playlist) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists, err := s.list(playlist.Owner)
+	if err != nil {
+		return err
+	}
+	if findPlaylist(playlists, playlist.Name) >= 0 {
+		return errPlaylistExists
+	}
+	if len(playlists) >= maxPlaylists {
+		return errTooManyPlaylists
+	}
+	return s.files.write(playlist.Owner.String(), append(playlists, playlist))
+}
+
+func (s *FilePlaylistStore) Update(_ context.Context, owner PlaylistOwner, name string, update func(playlist *Playlist) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists, err := s.list(owner)
+	if err != nil {
+		return err
+	}
+	i := findPlaylist(playlists, name)
+	if i < 0 {
+		return errPlaylistNotFound
+	}
+
+	playlist := playlists[i]
+	if err = update(&playlist); err != nil {
+		return err
+	}
+	// a renamed playlist mustn't replace another one, changing the case of its name is fine
+	if j := findPlaylist(playlists, playlist.Name); j >= 0 && j != i {
+		return errPlaylistExists
+	}
+	playlist.UpdatedAt = time.Now()
+	playlists[i] = playlist
+	return s.files.write(owner.String(), playlists)
+}
+
+func (s *FilePlaylistStore) Delete(_ context.Context, owner PlaylistOwner, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	playlists, err := s.list(owner)
+	if err != nil {
+		return err
+	}
+	i := findPlaylist(playlists, name)
+	if i < 0 {
+		return nil
+	}
+	playlists = slices.Delete(playlists, i, i+1)
+	if len(playlists) == 0 {
+		return s.files.remove(owner.String())
+	}
+	return s.files.write(owner.String(), playlists)
+}
+
+// returns the index of the playlist with the name, names are case-insensitive
+func findPlaylist(playlists []Playlist, name string) int {
+	return slices.IndexFunc(playlists, func(playlist Playlist) bool {
+		return strings.EqualFold(playlist.Name, name)
+	})
+}
+
+// describes why creating or changing the playlist with the name failed
+func playlistErrorMessage(err error, owner PlaylistOwner, name string) string {
+	switch {
+	case eris.Is(err, errPlaylistNotFound):
+		return fmt.Sprintf("There is no %s playlist called `%s`", owner.Scope, name)
+	case eris.Is(err, errPlaylistExists):
+		return fmt.Sprintf("There already is a %s playlist called `%s`", owner.Scope, name)
+	case eris.Is(err, errTooManyPlaylists):
+		return fmt.Sprintf("You can't have more than `%d` %s playlists", maxPlaylists, owner.Scope)
+	default:
+		return fmt.Sprintf("Error while saving playlist: `%s`", err)
+	}
+}
+
+// returns the owner of the playlist the command is about, based on its scope option
+func playlistOwner(event *handler.CommandEvent) PlaylistOwner {
+	if scope, _ := event.SlashCommandInteractionData().OptString("scope"); scope == playlistScopeGuild {
+		return PlaylistOwner{Scope: playlistScopeGuild, ID: *event.GuildID()}
+	}
+	return PlaylistOwner{Scope: playlistScopeUser, ID: event.User().ID}
+}
+
+// reports whether the user may change the playlists of the owner
+func (h CmdHandler) canEditPlaylists(event *handler.CommandEvent, owner PlaylistOwner) bool {
+	if owner.Scope == playlistScopeUser {
+		return owner.ID == event.User().ID
+	}
+	return event.Member() != nil && h.musicBot.Permissions.IsDJ(*event.GuildID(), *event.Member())
+}
+
+// loads the playlist the command is about, replies to the user if it can't
+func (h CmdHandler) loadPlaylist(event *handler.CommandEvent, edit bool) (Playlist, bool, error) {
+	owner := playlistOwner(event)
+	if edit && !h.canEditPlaylists(event, owner) {
+		return Playlist{}, false, event.CreateMessage(discord.MessageCreate{
+			Content: "Only DJs can change the playlists of this server",
+			Flags:   discord.MessageFlagEphemeral,
+		})
+	}
+
+	name := event.SlashCommandInteractionData().String("name")
+	playlists, err := h.musicBot.Playlists.List(context.TODO(), owner)
+	if err != nil {
+		return Playlist{}, false, event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while loading playlists: `%s`", err),
+		})
+	}
+	i := findPlaylist(playlists, name)
+	if i < 0 {
+		return Playlist{}, false, event.CreateMessage(discord.MessageCreate{
+			Content: playlistErrorMessage(errPlaylistNotFound, owner, name),
+		})
+	}
+	return playlists[i], true, nil
+}
+
+// saves a new playlist with the tracks, replies to the user with the result
+func (h CmdHandler) createPlaylist(event *handler.CommandEvent, tracks []lavalink.Track) error {
+	owner := playlistOwner(event)
+	if !h.canEditPlaylists(event, owner) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Only DJs can change the playlists of this server",
+			Flags:   discord.MessageFlagEphemeral,
+		})
+	}
+
+	name := event.SlashCommandInteractionData().String("name")
+	playlist := Playlist{
+		Name:      name,
+		Owner:     owner,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	for _, track := range tracks[:min(len(tracks), maxPlaylistTracks)] {
+		playlist.Tracks = append(playlist.Tracks, newPlaylistTrack(track))
+	}
+
+	if err := h.musicBot.Playlists.Create(context.TODO(), playlist); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: playlistErrorMessage(err, owner, name),
+		})
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Created %s playlist `%s` with %s", owner.Scope, name, pluralTracks(len(playlist.Tracks))),
+	})
+}
+
+// loads the tracks of a link or search query, search queries return their first result
+func (b *MusicBot) loadTracks(ctx context.Context, guildID snowflake.ID, identifier string) ([]lavalink.Track, error) {
+	if !urlPattern.MatchString(identifier) && !searchPattern.MatchString(identifier) {
+		identifier = b.searchType(guildID).Apply(identifier)
+	}
+	if source := identifierSource(identifier); !b.sourceAllowed(guildID, source) {
+		return nil, eris.Errorf("playing from %s isn't allowed on this server", source)
+	}
+
+	var (
+		tracks  []lavalink.Track
+		loadErr error
+	)
+	b.BestNode(guildID).LoadTracksHandler(ctx, identifier, disgolink.NewResultHandler(
+		func(track lavalink.Track) {
+			tracks = append(tracks, track)
+		},
+		func(playlist lavalink.Playlist) {
+			tracks = append(tracks, playlist.Tracks...)
+		},
+		func(results []lavalink.Track) {
+			tracks = append(tracks, results[0])
+		},
+		func() {
+			loadErr = eris.Errorf("nothing found for %s", identifier)
+		},
+		func(err error) {
+			loadErr = eris.Wrap(err, "error while loading tracks")
+		},
+	))
+	return tracks, loadErr
+}
+
+func (h CmdHandler) playlistCreate(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist create command")
+
+	return h.createPlaylist(event, nil)
+}
+
+func (h CmdHandler) playlistSave(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist save command")
+
+	tracks := h.musicBot.queueWithCurrent(*event.GuildID())
+	if len(tracks) == 0 {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "The queue is empty",
+		})
+	}
+
+	return h.createPlaylist(event, tracks)
+}
+
+func (h CmdHandler) playlistAdd(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist add command")
+
+	playlist, ok, err := h.loadPlaylist(event, true)
+	if !ok {
+		return err
+	}
+
+	var tracks []lavalink.Track
+	if identifier, ok := event.SlashCommandInteractionData().OptString("track"); ok {
+		if err = event.DeferCreateMessage(false); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if tracks, err = h.musicBot.loadTracks(ctx, *event.GuildID(), identifier); err != nil {
+			_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+				Content: json.Ptr(fmt.Sprintf("Error while loading tracks: `%s`", err)),
+			})
+			return err
+		}
+	} else if player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID()); player != nil && player.Track() != nil {
+		// add the current track if no track is given
+		tracks = append(tracks, *player.Track())
+		if err = event.DeferCreateMessage(false); err != nil {
+			return err
+		}
+	} else {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Nothing is playing, tell me which track to add",
+		})
+	}
+
+	var msg string
+	err = h.musicBot.Playlists.Update(context.TODO(), playlist.Owner, playlist.Name, func(playlist *Playlist) error {
+		free := maxPlaylistTracks - len(playlist.Tracks)
+		msg = fmt.Sprintf("Added %s to playlist `%s`", pluralTracks(min(len(tracks), free)), playlist.Name)
+		if len(tracks) > free {
+			msg += fmt.Sprintf("\nSkipped %s because playlists are limited to `%d` tracks", pluralTracks(len(tracks)-free), maxPlaylistTracks)
+		}
+		for _, track := range tracks[:min(len(tracks), free)] {
+			playlist.Tracks = append(playlist.Tracks, newPlaylistTrack(track))
+		}
+		return nil
+	})
+	if err != nil {
+		msg = playlistErrorMessage(err, playlist.Owner, playlist.Name)
+	}
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: &msg,
+	})
+	return err
+}
+
+func (h CmdHandler) playlistRemove(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist remove command")
+
+	playlist, ok, err := h.loadPlaylist(event, true)
+	if !ok {
+		return err
+	}
+
+	from, to, parseErr := parsePositionRange(event.SlashCommandInteractionData().String("position"))
+	if eris.Is(parseErr, errReversedRange) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: reversedRangeMessage(from, to),
+		})
+	}
+
+	// the positions are checked against the saved playlist, tracks may have been added or removed since it was loaded
+	length := len(playlist.Tracks)
+	err = h.musicBot.Playlists.Update(context.TODO(), playlist.Owner, playlist.Name, func(playlist *Playlist) error {
+		length = len(playlist.Tracks)
+		if parseErr != nil || from < 1 || from > to || to > length {
+			return errInvalidPosition
+		}
+		playlist.Tracks = slices.Delete(playlist.Tracks, from-1, to)
+		return nil
+	})
+	if eris.Is(err, errInvalidPosition) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Position must be between `1` and `%d`, or a range like `2-5`", length),
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: playlistErrorMessage(err, playlist.Owner, playlist.Name),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Removed %s from playlist `%s`", pluralTracks(to-from+1), playlist.Name),
+	})
+}
+
+func (h CmdHandler) playlistList(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist list command")
+
+	// show the tracks of a single playlist if a name is given
+	if _, ok := event.SlashCommandInteractionData().OptString("name"); ok {
+		playlist, ok, err := h.loadPlaylist(event, false)
+		if !ok {
+			return err
+		}
+		return event.CreateMessage(discord.MessageCreate{
+			Embeds: []discord.Embed{playlistEmbed(playlist)},
+		})
+	}
+
+	owner := playlistOwner(event)
+	playlists, err := h.musicBot.Playlists.List(context.TODO(), owner)
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while loading playlists: `%s`", err),
+		})
+	}
+	if len(playlists) == 0 {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("There are no %s playlists yet", owner.Scope),
+		})
+	}
+
+	var description strings.Builder
+	for _, playlist := range playlists {
+		description.WriteString(fmt.Sprintf("`%s` - %s\n", playlist.Name, pluralTracks(len(playlist.Tracks))))
+	}
+
+	title := "Your playlists"
+	if owner.Scope == playlistScopeGuild {
+		title = "Server playlists"
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Embeds: []discord.Embed{discord.NewEmbedBuilder().
+			SetTitle(title).
+			SetDescription(description.String()).
+			Build(),
+		},
+	})
+}
+
+// builds the embed showing the first tracks of the playlist
+func playlistEmbed(playlist Playlist) discord.Embed {
+	var (
+		description strings.Builder
+		length      lavalink.Duration
+	)
+	for i, track := range playlist.Tracks {
+		length += track.Length
+		if i >= queuePageSize {
+			continue
+		}
+		if track.URI != nil {
+			description.WriteString(fmt.Sprintf("%d. [`%s`](<%s>) `%s`\n", i+1, track.Title, *track.URI, formatPosition(track.Length)))
+		} else {
+			description.WriteString(fmt.Sprintf("%d. `%s` `%s`\n", i+1, track.Title, formatPosition(track.Length)))
+		}
+	}
+	if len(playlist.Tracks) > queuePageSize {
+		description.WriteString(fmt.Sprintf("and %s more", pluralTracks(len(playlist.Tracks)-queuePageSize)))
+	}
+	if len(playlist.Tracks) == 0 {
+		description.WriteString("This playlist is empty")
+	}
+
+	return discord.NewEmbedBuilder().
+		SetTitle(playlist.Name).
+		SetDescription(description.String()).
+		SetFooterTextf("%d tracks • %s", len(playlist.Tracks), formatPosition(length)).
+		Build()
+}
+
+func (h CmdHandler) playlistPlay(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist play command")
+
+	voiceState, ok := h.musicBot.Client.Caches().VoiceState(*event.GuildID(), event.User().ID)
+	if !ok || voiceState.ChannelID == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "You need to be in a voice channel to use this command",
+		})
+	}
+
+	playlist, ok, err := h.loadPlaylist(event, false)
+	if !ok {
+		return err
+	}
+	if len(playlist.Tracks) == 0 {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Playlist `%s` is empty", playlist.Name),
+		})
+	}
+
+	if err = event.DeferCreateMessage(false); err != nil {
+		return err
+	}
+	h.musicBot.Announcer.SetChannel(*event.GuildID(), event.ChannelID())
+
+	encoded := make([]string, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		encoded = append(encoded, track.Encoded)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tracks, err := h.musicBot.BestNode(*event.GuildID()).DecodeTracks(ctx, encoded)
+	if err != nil {
+		_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+			Content: json.Ptr(fmt.Sprintf("Error while loading playlist: `%s`", err)),
+		})
+		return err
+	}
+	if shuffle, _ := event.SlashCommandInteractionData().OptBool("shuffle"); shuffle {
+		rand.Shuffle(len(tracks), func(i, j int) {
+			tracks[i], tracks[j] = tracks[j], tracks[i]
+		})
+	}
+
+	msg, err := h.enqueue(*event.GuildID(), *voiceState.ChannelID, withRequest(tracks, TrackRequest{
+		UserID:        event.User().ID,
+		ChannelID:     event.ChannelID(),
+		InteractionID: event.ID(),
+		RequestedAt:   time.Now(),
+	}))
+	if err != nil {
+		logger.Error("Failed to play playlist", tint.Err(eris.Wrap(err, "failed to play playlist")))
+	}
+
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: &msg,
+	})
+	return err
+}
+
+func (h CmdHandler) playlistDelete(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist delete command")
+
+	playlist, ok, err := h.loadPlaylist(event, true)
+	if !ok {
+		return err
+	}
+
+	if err = h.musicBot.Playlists.Delete(context.TODO(), playlist.Owner, playlist.Name); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while deleting playlist: `%s`", err),
+		})
+	}
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Deleted playlist `%s`", playlist.Name),
+	})
+}
+
+func (h CmdHandler) playlistRename(event *handler.CommandEvent) error {
+	logger.Info("Received /playlist rename command")
+
+	playlist, ok, err := h.loadPlaylist(event, true)
+	if !ok {
+		return err
+	}
+
+	oldName := playlist.Name
+	newName := event.SlashCommandInteractionData().String("new-name")
+	err = h.musicBot.Playlists.Update(context.TODO(), playlist.Owner, oldName, func(playlist *Playlist) error {
+		playlist.Name = newName
+		return nil
+	})
+	if eris.Is(err, errPlaylistExists) {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: playlistErrorMessage(err, playlist.Owner, newName),
+		})
+	}
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: playlistErrorMessage(err, playlist.Owner, oldName),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Renamed playlist `%s` to `%s`", oldName, newName),
+	})
+}
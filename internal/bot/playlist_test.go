@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rotisserie/eris"
+)
+
+func TestFilePlaylistStoreConcurrentUpdates(t *testing.T) {
+	store := NewFilePlaylistStore(t.TempDir())
+	ctx := context.Background()
+	owner := PlaylistOwner{Scope: playlistScopeGuild, ID: 1}
+
+	if err := store.Create(ctx, Playlist{Name: "mix", Owner: owner}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every worker adds a track, none of them may get lost
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			err := store.Update(ctx, owner, "MIX", func(playlist *Playlist) error {
+				playlist.Tracks = append(playlist.Tracks, PlaylistTrack{Title: fmt.Sprintf("track %d", w)})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	playlists, err := store.List(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlists) != 1 || len(playlists[0].Tracks) != testWorkers {
+		t.Fatalf("got %d playlists, want 1 with %d tracks", len(playlists), testWorkers)
+	}
+}
+
+func TestFilePlaylistStoreConcurrentCreates(t *testing.T) {
+	store := NewFilePlaylistStore(t.TempDir())
+	ctx := context.Background()
+	owner := PlaylistOwner{Scope: playlistScopeUser, ID: 1}
+
+	var (
+		wg      sync.WaitGroup
+		created atomic.Int32
+	)
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Create(ctx, Playlist{Name: "mix", Owner: owner})
+			if err == nil {
+				created.Add(1)
+			} else if !eris.Is(err, errPlaylistExists) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if created.Load() != 1 {
+		t.Errorf("created the playlist %d times, want once", created.Load())
+	}
+}
+
+func TestFilePlaylistStoreUpdate(t *testing.T) {
+	store := NewFilePlaylistStore(t.TempDir())
+	ctx := context.Background()
+	owner := PlaylistOwner{Scope: playlistScopeUser, ID: 1}
+
+	for _, name := range []string{"first", "second"} {
+		if err := store.Create(ctx, Playlist{Name: name, Owner: owner}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rename := func(name string) func(playlist *Playlist) error {
+		return func(playlist *Playlist) error {
+			playlist.Name = name
+			return nil
+		}
+	}
+	if err := store.Update(ctx, owner, "first", rename("Second")); !eris.Is(err, errPlaylistExists) {
+		t.Errorf("renaming to another playlist = %v, want %v", err, errPlaylistExists)
+	}
+	if err := store.Update(ctx, owner, "third", rename("fourth")); !eris.Is(err, errPlaylistNotFound) {
+		t.Errorf("renaming a missing playlist = %v, want %v", err, errPlaylistNotFound)
+	}
+	if err := store.Update(ctx, owner, "first", rename("First")); err != nil {
+		t.Errorf("changing the case of the name failed: %s", err)
+	}
+	if err := store.Update(ctx, owner, "first", func(playlist *Playlist) error {
+		playlist.Tracks = append(playlist.Tracks, PlaylistTrack{Title: "track"})
+		return errInvalidPosition
+	}); !eris.Is(err, errInvalidPosition) {
+		t.Errorf("failing update = %v, want %v", err, errInvalidPosition)
+	}
+
+	playlists, err := store.List(ctx, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlists) != 2 || playlists[0].Name != "First" || playlists[1].Name != "second" {
+		t.Fatalf("got playlists %+v, want First and second", playlists)
+	}
+	if len(playlists[0].Tracks) != 0 {
+		t.Errorf("failing update was saved")
+	}
+}
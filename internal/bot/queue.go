@@ -2,6 +2,8 @@ package bot
 
 import (
 	"math/rand"
+	"slices"
+	"sync"
 
 	"github.com/disgoorg/snowflake/v2"
 
@@ -29,66 +31,244 @@ func (q QueueType) String() string {
 	}
 }
 
+// Queue is the music queue of a single guild.
+// All methods are safe for concurrent use.
 type Queue struct {
-	Tracks []lavalink.Track
-	Type   QueueType
+	mu     sync.Mutex
+	tracks []lavalink.Track
+	typ    QueueType
+}
+
+func newQueue() *Queue {
+	return &Queue{
+		tracks: make([]lavalink.Track, 0),
+		typ:    QueueTypeNormal,
+	}
+}
+
+// returns a copy of the queued tracks
+func (q *Queue) Tracks() []lavalink.Track {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]lavalink.Track(nil), q.tracks...)
+}
+
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tracks)
+}
+
+func (q *Queue) Type() QueueType {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.typ
+}
+
+func (q *Queue) SetType(queueType QueueType) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.typ = queueType
 }
 
 func (q *Queue) Shuffle() {
-	rand.Shuffle(len(q.Tracks), func(i, j int) {
-		q.Tracks[i], q.Tracks[j] = q.Tracks[j], q.Tracks[i]
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rand.Shuffle(len(q.tracks), func(i, j int) {
+		q.tracks[i], q.tracks[j] = q.tracks[j], q.tracks[i]
 	})
 }
 
 func (q *Queue) Add(track ...lavalink.Track) {
-	q.Tracks = append(q.Tracks, track...)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = append(q.tracks, track...)
 }
 
-func (q *Queue) Next() (lavalink.Track, bool) {
-	if len(q.Tracks) == 0 {
-		return lavalink.Track{}, false
+// adds the tracks to the front of the queue, so they are played next
+func (q *Queue) AddNext(track ...lavalink.Track) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = append(slices.Clone(track), q.tracks...)
+}
+
+// adds the tracks in front of the first queued track matching before, or to the end if none does
+func (q *Queue) AddBefore(before func(track lavalink.Track) bool, track ...lavalink.Track) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	index := slices.IndexFunc(q.tracks, before)
+	if index == -1 {
+		q.tracks = append(q.tracks, track...)
+		return
 	}
-	track := q.Tracks[0]
-	q.Tracks = q.Tracks[1:]
-	return track, true
+	q.tracks = slices.Insert(q.tracks, index, track...)
+}
+
+func (q *Queue) Next() (lavalink.Track, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.skip(1)
 }
 
 func (q *Queue) Skip(amount int) (lavalink.Track, bool) {
-	if len(q.Tracks) == 0 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.skip(amount)
+}
+
+// removes the next amount tracks and returns the last removed one, q.mu must be held
+func (q *Queue) skip(amount int) (lavalink.Track, bool) {
+	if len(q.tracks) == 0 {
 		return lavalink.Track{}, false
 	}
-	if amount > len(q.Tracks) {
-		amount = len(q.Tracks)
+	if amount < 1 {
+		amount = 1
+	}
+	if amount > len(q.tracks) {
+		amount = len(q.tracks)
 	}
 
 	// get next track to play
-	track := q.Tracks[amount-1]
+	track := q.tracks[amount-1]
 
 	// shift queue
-	q.Tracks = q.Tracks[amount:]
+	q.tracks = q.tracks[amount:]
+	return track, true
+}
+
+// SkipAndPlay removes the next amount tracks and calls play with the last removed one, all while holding the queue lock.
+// If play fails the queue is left unchanged, so concurrent skips and track ends can't lose or double play tracks.
+func (q *Queue) SkipAndPlay(amount int, play func(track lavalink.Track) error) (lavalink.Track, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tracks := q.tracks
+	track, ok := q.skip(amount)
+	if !ok {
+		return lavalink.Track{}, false, nil
+	}
+
+	if err := play(track); err != nil {
+		q.tracks = tracks
+		return track, true, err
+	}
+	return track, true, nil
+}
+
+// NextAndPlay is SkipAndPlay for the next track
+func (q *Queue) NextAndPlay(play func(track lavalink.Track) error) (lavalink.Track, bool, error) {
+	return q.SkipAndPlay(1, play)
+}
+
+// JumpAndPlay removes the track at index and calls play with it, all while holding the queue lock.
+// The tracks before index stay in the queue. If play fails the queue is left unchanged.
+func (q *Queue) JumpAndPlay(index int, play func(track lavalink.Track) error) (lavalink.Track, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if index < 0 || index >= len(q.tracks) {
+		return lavalink.Track{}, false, nil
+	}
+
+	tracks := q.tracks
+	track := q.tracks[index]
+	q.tracks = append(append(make([]lavalink.Track, 0, len(tracks)-1), tracks[:index]...), tracks[index+1:]...)
+
+	if err := play(track); err != nil {
+		q.tracks = tracks
+		return track, true, err
+	}
+	return track, true, nil
+}
+
+// removes the tracks from index from to index to (both inclusive) and returns them.
+// returns false if the range is out of bounds.
+func (q *Queue) Remove(from int, to int) ([]lavalink.Track, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if from < 0 || to < from || to >= len(q.tracks) {
+		return nil, false
+	}
+
+	removed := append([]lavalink.Track(nil), q.tracks[from:to+1]...)
+	q.tracks = append(q.tracks[:from], q.tracks[to+1:]...)
+	return removed, true
+}
+
+// moves the track at index from to index to, shifting the tracks in between.
+// returns false if either index is out of bounds.
+func (q *Queue) Move(from int, to int) (lavalink.Track, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if from < 0 || from >= len(q.tracks) || to < 0 || to >= len(q.tracks) {
+		return lavalink.Track{}, false
+	}
+
+	track := q.tracks[from]
+	if from < to {
+		copy(q.tracks[from:to], q.tracks[from+1:to+1])
+	} else {
+		copy(q.tracks[to+1:from+1], q.tracks[to:from])
+	}
+	q.tracks[to] = track
 	return track, true
 }
 
 func (q *Queue) Clear() {
-	q.Tracks = make([]lavalink.Track, 0)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.tracks = make([]lavalink.Track, 0)
 }
 
+// QueueManager holds the queues of all guilds.
+// All methods are safe for concurrent use.
 type QueueManager struct {
+	mu     sync.RWMutex
 	queues map[snowflake.ID]*Queue
 }
 
+func NewQueueManager() *QueueManager {
+	return &QueueManager{
+		queues: make(map[snowflake.ID]*Queue),
+	}
+}
+
+// returns the queue of the guild, creating it if it doesn't exist yet
 func (q *QueueManager) Get(guildID snowflake.ID) *Queue {
+	q.mu.RLock()
 	queue, ok := q.queues[guildID]
-	if !ok {
-		queue = &Queue{
-			Tracks: make([]lavalink.Track, 0),
-			Type:   QueueTypeNormal,
-		}
-		q.queues[guildID] = queue
+	q.mu.RUnlock()
+	if ok {
+		return queue
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// another goroutine might have created the queue in the meantime
+	if queue, ok = q.queues[guildID]; ok {
+		return queue
 	}
+	queue = newQueue()
+	q.queues[guildID] = queue
 	return queue
 }
 
 func (q *QueueManager) Delete(guildID snowflake.ID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
 	delete(q.queues, guildID)
 }
+
+// returns the ids of all guilds with a queue
+func (q *QueueManager) GuildIDs() []snowflake.ID {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	guildIDs := make([]snowflake.ID, 0, len(q.queues))
+	for guildID := range q.queues {
+		guildIDs = append(guildIDs, guildID)
+	}
+	return guildIDs
+}
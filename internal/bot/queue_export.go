@@ -0,0 +1,316 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// maximum size of an imported file
+	maxImportSize = 1 << 20
+	// maximum amount of entries read from an imported file
+	maxImportEntries = 500
+	// maximum amount of failed entries listed after an import
+	maxImportFailuresShown = 10
+)
+
+// version of the exported json format, bumped on incompatible changes
+const queueExportVersion = 1
+
+// json document /queue export creates and /queue import reads
+type queueExport struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Tracks     []exportedTrack `json:"tracks"`
+}
+
+// a single track of an exported queue.
+// the encoded track is used to import it again, the uri is resolved if decoding fails.
+type exportedTrack struct {
+	Encoded string            `json:"encoded"`
+	Title   string            `json:"title"`
+	Author  string            `json:"author"`
+	URI     *string           `json:"uri,omitempty"`
+	Length  lavalink.Duration `json:"length"`
+}
+
+// returns the current track and the queue of the guild
+func (b *MusicBot) queueWithCurrent(guildID snowflake.ID) []lavalink.Track {
+	var tracks []lavalink.Track
+	if player := b.Lavalink.ExistingPlayer(guildID); player != nil && player.Track() != nil {
+		tracks = append(tracks, *player.Track())
+	}
+	return append(tracks, b.Queues.Get(guildID).Tracks()...)
+}
+
+// builds the json export of the tracks
+func exportJSON(tracks []lavalink.Track) ([]byte, error) {
+	export := queueExport{
+		Version:    queueExportVersion,
+		ExportedAt: time.Now(),
+		Tracks:     make([]exportedTrack, 0, len(tracks)),
+	}
+	for _, track := range tracks {
+		export.Tracks = append(export.Tracks, exportedTrack{
+			Encoded: track.Encoded,
+			Title:   track.Info.Title,
+			Author:  track.Info.Author,
+			URI:     track.Info.URI,
+			Length:  track.Info.Length,
+		})
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// builds an extended m3u playlist of the tracks, tracks without a uri are left out
+func exportM3U(tracks []lavalink.Track) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		if track.Info.URI == nil {
+			continue
+		}
+		length := -1
+		if !track.Info.IsStream {
+			length = int(track.Info.Length.Seconds())
+		}
+		fmt.Fprintf(&buf, "#EXTINF:%d,%s - %s\n%s\n", length, track.Info.Author, track.Info.Title, *track.Info.URI)
+	}
+	return buf.Bytes()
+}
+
+func (h CmdHandler) queueExport(event *handler.CommandEvent) error {
+	logger.Info("Received /queue export command")
+
+	tracks := h.musicBot.queueWithCurrent(*event.GuildID())
+	if len(tracks) == 0 {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "The queue is empty",
+		})
+	}
+
+	data, err := exportJSON(tracks)
+	if err != nil {
+		return eris.Wrap(err, "error while exporting queue")
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Exported %s, use `/queue import` with one of these files to add them to a queue", pluralTracks(len(tracks))),
+		Files: []*discord.File{
+			discord.NewFile("queue.json", "Queue with encoded tracks", bytes.NewReader(data)),
+			discord.NewFile("queue.m3u", "Queue as a playlist of links", bytes.NewReader(exportM3U(tracks))),
+		},
+	})
+}
+
+// an entry of an imported file, either an encoded track or something to resolve
+type importEntry struct {
+	// shown to the user if the entry can't be imported
+	name    string
+	encoded string
+	// link or search query to resolve if there is no encoded track or it can't be decoded
+	identifier string
+}
+
+// parses an exported json queue, or a m3u or text file with one link per line
+func parseImport(filename string, data []byte) ([]importEntry, error) {
+	var entries []importEntry
+
+	if path.Ext(strings.ToLower(filename)) == ".json" || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var export queueExport
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, eris.Wrap(err, "invalid queue export")
+		}
+		if export.Version > queueExportVersion {
+			return nil, eris.Errorf("queue export version %d isn't supported", export.Version)
+		}
+		for _, track := range export.Tracks {
+			entry := importEntry{
+				name:       track.Title,
+				encoded:    track.Encoded,
+				identifier: track.Author + " " + track.Title,
+			}
+			if track.URI != nil {
+				entry.identifier = *track.URI
+			}
+			entries = append(entries, entry)
+		}
+		return entries, nil
+	}
+
+	// m3u and plain lists share the format, m3u only adds comments
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, importEntry{name: line, identifier: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, eris.Wrap(err, "error while reading file")
+	}
+	return entries, nil
+}
+
+// downloads an attachment, failing if it's bigger than maxImportSize
+func downloadAttachment(ctx context.Context, attachment discord.Attachment) ([]byte, error) {
+	if attachment.Size > maxImportSize {
+		return nil, eris.Errorf("the file is bigger than %d KiB", maxImportSize/1024)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL, nil)
+	if err != nil {
+		return nil, eris.Wrap(err, "error while creating request")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, eris.Wrap(err, "error while downloading file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, eris.Errorf("error while downloading file: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxImportSize))
+}
+
+// turns the entries into tracks. Encoded tracks are decoded, everything else
+// and tracks which can't be decoded anymore are resolved through lavalink.
+// returns the tracks and the names of the entries which couldn't be imported.
+func (b *MusicBot) resolveImport(ctx context.Context, guildID snowflake.ID, entries []importEntry) ([]lavalink.Track, []string) {
+	node := b.BestNode(guildID)
+
+	// try decoding everything at once first, it fails as a whole if a single track is broken
+	var encoded []string
+	for _, entry := range entries {
+		if entry.encoded == "" {
+			break
+		}
+		encoded = append(encoded, entry.encoded)
+	}
+	if len(encoded) == len(entries) {
+		if tracks, err := node.DecodeTracks(ctx, encoded); err == nil && len(tracks) == len(entries) {
+			return tracks, nil
+		}
+	}
+
+	var (
+		tracks []lavalink.Track
+		failed []string
+	)
+	for _, entry := range entries {
+		if entry.encoded != "" {
+			if track, err := node.DecodeTrack(ctx, entry.encoded); err == nil {
+				tracks = append(tracks, *track)
+				continue
+			}
+		}
+
+		resolved, err := b.loadTracks(ctx, guildID, entry.identifier)
+		if err != nil {
+			logger.Debug("could not resolve imported entry", tint.Err(err))
+			failed = append(failed, entry.name)
+			continue
+		}
+		tracks = append(tracks, resolved...)
+	}
+	return tracks, failed
+}
+
+func (h CmdHandler) queueImport(event *handler.CommandEvent) error {
+	logger.Info("Received /queue import command")
+
+	voiceState, ok := h.musicBot.Client.Caches().VoiceState(*event.GuildID(), event.User().ID)
+	if !ok || voiceState.ChannelID == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "You need to be in a voice channel to use this command",
+		})
+	}
+
+	if err := event.DeferCreateMessage(false); err != nil {
+		return err
+	}
+	h.musicBot.Announcer.SetChannel(*event.GuildID(), event.ChannelID())
+
+	// resolving can take a while for long lists, the interaction stays valid for 15 minutes
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	msg, err := h.importQueue(ctx, event, *voiceState.ChannelID)
+	if err != nil {
+		logger.Error("Failed to import queue", tint.Err(eris.Wrap(err, "failed to import queue")))
+	}
+
+	_, err = h.musicBot.Client.Rest().UpdateInteractionResponse(event.ApplicationID(), event.Token(), discord.MessageUpdate{
+		Content: &msg,
+	})
+	return err
+}
+
+// imports the attached file into the queue, returns the message to show to the user
+func (h CmdHandler) importQueue(ctx context.Context, event *handler.CommandEvent, channelID snowflake.ID) (string, error) {
+	attachment := event.SlashCommandInteractionData().Attachment("file")
+
+	data, err := downloadAttachment(ctx, attachment)
+	if err != nil {
+		return fmt.Sprintf("Error while downloading `%s`: `%s`", attachment.Filename, err), nil
+	}
+
+	entries, err := parseImport(attachment.Filename, data)
+	if err != nil {
+		return fmt.Sprintf("Error while reading `%s`: `%s`", attachment.Filename, err), nil
+	}
+	if len(entries) == 0 {
+		return fmt.Sprintf("`%s` doesn't contain any tracks", attachment.Filename), nil
+	}
+
+	var notes []string
+	if len(entries) > maxImportEntries {
+		notes = append(notes, fmt.Sprintf("Only the first `%d` of `%d` entries were imported", maxImportEntries, len(entries)))
+		entries = entries[:maxImportEntries]
+	}
+
+	tracks, failed := h.musicBot.resolveImport(ctx, *event.GuildID(), entries)
+	if len(failed) > 0 {
+		note := fmt.Sprintf("Couldn't import `%d` entries:", len(failed))
+		for _, name := range failed[:min(len(failed), maxImportFailuresShown)] {
+			note += fmt.Sprintf("\n- `%s`", truncate(name, 100))
+		}
+		if len(failed) > maxImportFailuresShown {
+			note += fmt.Sprintf("\nand `%d` more", len(failed)-maxImportFailuresShown)
+		}
+		notes = append(notes, note)
+	}
+
+	msg := "Nothing could be imported"
+	if len(tracks) > 0 {
+		msg, err = h.enqueue(*event.GuildID(), channelID, withRequest(tracks, TrackRequest{
+			UserID:        event.User().ID,
+			ChannelID:     event.ChannelID(),
+			InteractionID: event.ID(),
+			RequestedAt:   time.Now(),
+		}))
+	}
+	if len(notes) > 0 {
+		msg += "\n" + strings.Join(notes, "\n")
+	}
+
+	// discord rejects messages longer than 2000 characters
+	return truncate(msg, 2000), err
+}
@@ -0,0 +1,473 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	testWorkers         = 16
+	testTracksPerWorker = 50
+)
+
+func testTrack(i int) lavalink.Track {
+	return lavalink.Track{
+		Encoded: fmt.Sprintf("encoded-%d", i),
+		Info: lavalink.TrackInfo{
+			Identifier: fmt.Sprintf("track-%d", i),
+			SourceName: "test",
+			Title:      fmt.Sprintf("Track %d", i),
+		},
+	}
+}
+
+func testTracks(n int) []lavalink.Track {
+	tracks := make([]lavalink.Track, n)
+	for i := range tracks {
+		tracks[i] = testTrack(i)
+	}
+	return tracks
+}
+
+// counts how often each track was seen and fails if one wasn't seen exactly once
+type trackCounter struct {
+	mu   sync.Mutex
+	seen map[string]int
+}
+
+func (c *trackCounter) add(track lavalink.Track) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]int)
+	}
+	c.seen[track.Encoded]++
+}
+
+func (c *trackCounter) check(t *testing.T, n int) {
+	t.Helper()
+	if len(c.seen) != n {
+		t.Errorf("saw %d different tracks, want %d", len(c.seen), n)
+	}
+	for encoded, count := range c.seen {
+		if count != 1 {
+			t.Errorf("saw %s %d times, want once", encoded, count)
+		}
+	}
+}
+
+func TestQueueConcurrentAddAndNext(t *testing.T) {
+	queue := newQueue()
+	total := testWorkers * testTracksPerWorker
+
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < testTracksPerWorker; i++ {
+				track := testTrack(w*testTracksPerWorker + i)
+				if i%2 == 0 {
+					queue.Add(track)
+				} else {
+					queue.AddNext(track)
+				}
+			}
+		}(w)
+	}
+
+	var (
+		taken   trackCounter
+		removed atomic.Int64
+	)
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for removed.Load() < int64(total) {
+				if track, ok := queue.Next(); ok {
+					taken.add(track)
+					removed.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	taken.check(t, total)
+	if queue.Len() != 0 {
+		t.Errorf("queue has %d tracks left, want 0", queue.Len())
+	}
+}
+
+func TestQueueConcurrentPlay(t *testing.T) {
+	total := testWorkers * testTracksPerWorker
+	queue := newQueue()
+	queue.Add(testTracks(total)...)
+
+	var (
+		played trackCounter
+		calls  atomic.Int64
+	)
+	// fails every third call, the track has to stay in the queue then
+	play := func(track lavalink.Track) error {
+		if calls.Add(1)%3 == 0 {
+			return errors.New("play failed")
+		}
+		played.add(track)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for queue.Len() > 0 {
+				switch w % 3 {
+				case 0:
+					queue.SkipAndPlay(1, play)
+				case 1:
+					queue.NextAndPlay(play)
+				case 2:
+					queue.JumpAndPlay(0, play)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	played.check(t, total)
+}
+
+func TestQueueConcurrentJumpAndPlayOutOfBounds(t *testing.T) {
+	queue := newQueue()
+	queue.Add(testTracks(testWorkers)...)
+
+	var played trackCounter
+	play := func(track lavalink.Track) error {
+		played.add(track)
+		return nil
+	}
+
+	// every worker jumps to the last position, the queue shrinks while they do
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers*2; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue.JumpAndPlay(testWorkers-1, play)
+		}()
+	}
+	wg.Wait()
+
+	if len(played.seen) > 1 {
+		t.Errorf("played %d tracks at the last position, want at most 1", len(played.seen))
+	}
+	played.check(t, len(played.seen))
+}
+
+func TestQueueConcurrentMutations(t *testing.T) {
+	queue := newQueue()
+	queue.Add(testTracks(testTracksPerWorker)...)
+
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < testTracksPerWorker; i++ {
+				switch (w + i) % 7 {
+				case 0:
+					queue.Add(testTrack(w*testTracksPerWorker + i))
+				case 1:
+					queue.AddNext(testTrack(w*testTracksPerWorker + i))
+				case 2:
+					queue.Remove(0, 1)
+				case 3:
+					queue.Move(0, queue.Len()-1)
+				case 4:
+					queue.Shuffle()
+				case 5:
+					if i%10 == 0 {
+						queue.Clear()
+					}
+				case 6:
+					for _, track := range queue.Tracks() {
+						_ = track.Encoded
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if tracks := queue.Tracks(); len(tracks) != queue.Len() {
+		t.Errorf("Tracks() has %d tracks, Len() is %d", len(tracks), queue.Len())
+	}
+}
+
+func TestQueueConcurrentRemoveAndMove(t *testing.T) {
+	total := testWorkers * testTracksPerWorker
+	queue := newQueue()
+	queue.Add(testTracks(total)...)
+
+	var (
+		removed trackCounter
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for {
+				if w%2 == 0 {
+					queue.Move(queue.Len()-1, 0)
+				}
+				tracks, ok := queue.Remove(0, 0)
+				if !ok {
+					return
+				}
+				for _, track := range tracks {
+					removed.add(track)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// moving never loses or duplicates tracks
+	removed.check(t, total)
+}
+
+func TestQueueManagerConcurrentGet(t *testing.T) {
+	manager := NewQueueManager()
+	guildID := snowflake.ID(1)
+
+	queues := make([]*Queue, testWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			queues[w] = manager.Get(guildID)
+			queues[w].Add(testTrack(w))
+		}(w)
+	}
+	wg.Wait()
+
+	for w, queue := range queues {
+		if queue != queues[0] {
+			t.Fatalf("worker %d got a different queue", w)
+		}
+	}
+	if queues[0].Len() != testWorkers {
+		t.Errorf("queue has %d tracks, want %d", queues[0].Len(), testWorkers)
+	}
+}
+
+func TestQueueManagerConcurrentGetAndDelete(t *testing.T) {
+	manager := NewQueueManager()
+
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < testTracksPerWorker; i++ {
+				guildID := snowflake.ID(i%4 + 1)
+				switch (w + i) % 3 {
+				case 0:
+					manager.Get(guildID).Add(testTrack(i))
+				case 1:
+					manager.Delete(guildID)
+				case 2:
+					for _, id := range manager.GuildIDs() {
+						manager.Get(id).Len()
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < 4; w++ {
+		manager.Delete(snowflake.ID(w + 1))
+	}
+	if guildIDs := manager.GuildIDs(); len(guildIDs) != 0 {
+		t.Errorf("%d queues left after deleting all, want 0", len(guildIDs))
+	}
+}
+
+// identifiers of the tracks, to compare queues in errors
+func trackNames(tracks []lavalink.Track) []string {
+	names := make([]string, len(tracks))
+	for i, track := range tracks {
+		names[i] = track.Info.Identifier
+	}
+	return names
+}
+
+func TestQueueRemoveBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		ok       bool
+		removed  []string
+		left     []string
+	}{
+		{name: "first", from: 0, to: 0, ok: true, removed: []string{"track-0"}, left: []string{"track-1", "track-2", "track-3", "track-4"}},
+		{name: "last", from: 4, to: 4, ok: true, removed: []string{"track-4"}, left: []string{"track-0", "track-1", "track-2", "track-3"}},
+		{name: "range", from: 1, to: 3, ok: true, removed: []string{"track-1", "track-2", "track-3"}, left: []string{"track-0", "track-4"}},
+		{name: "everything", from: 0, to: 4, ok: true, removed: []string{"track-0", "track-1", "track-2", "track-3", "track-4"}, left: []string{}},
+		{name: "negative", from: -1, to: 0},
+		{name: "past the end", from: 5, to: 5},
+		{name: "range past the end", from: 3, to: 5},
+		{name: "reversed", from: 3, to: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newQueue()
+			queue.Add(testTracks(5)...)
+
+			removed, ok := queue.Remove(tt.from, tt.to)
+			if ok != tt.ok {
+				t.Fatalf("Remove(%d, %d) ok = %v, want %v", tt.from, tt.to, ok, tt.ok)
+			}
+			if !ok {
+				if queue.Len() != 5 {
+					t.Errorf("failed Remove changed the queue to %v", trackNames(queue.Tracks()))
+				}
+				return
+			}
+			if got := trackNames(removed); fmt.Sprint(got) != fmt.Sprint(tt.removed) {
+				t.Errorf("removed %v, want %v", got, tt.removed)
+			}
+			if got := trackNames(queue.Tracks()); fmt.Sprint(got) != fmt.Sprint(tt.left) {
+				t.Errorf("queue is %v, want %v", got, tt.left)
+			}
+		})
+	}
+}
+
+func TestQueueMoveBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to int
+		ok       bool
+		want     []string
+	}{
+		{name: "forward", from: 0, to: 3, ok: true, want: []string{"track-1", "track-2", "track-3", "track-0", "track-4"}},
+		{name: "backward", from: 4, to: 1, ok: true, want: []string{"track-0", "track-4", "track-1", "track-2", "track-3"}},
+		{name: "same position", from: 2, to: 2, ok: true, want: []string{"track-0", "track-1", "track-2", "track-3", "track-4"}},
+		{name: "negative from", from: -1, to: 2},
+		{name: "negative to", from: 2, to: -1},
+		{name: "from past the end", from: 5, to: 0},
+		{name: "to past the end", from: 0, to: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newQueue()
+			queue.Add(testTracks(5)...)
+
+			_, ok := queue.Move(tt.from, tt.to)
+			if ok != tt.ok {
+				t.Fatalf("Move(%d, %d) ok = %v, want %v", tt.from, tt.to, ok, tt.ok)
+			}
+			want := tt.want
+			if !ok {
+				want = trackNames(testTracks(5))
+			}
+			if got := trackNames(queue.Tracks()); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("queue is %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueueJumpAndPlayBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		index  int
+		ok     bool
+		played string
+		left   []string
+	}{
+		{name: "first", index: 0, ok: true, played: "track-0", left: []string{"track-1", "track-2"}},
+		{name: "middle", index: 1, ok: true, played: "track-1", left: []string{"track-0", "track-2"}},
+		{name: "last", index: 2, ok: true, played: "track-2", left: []string{"track-0", "track-1"}},
+		{name: "negative", index: -1},
+		{name: "past the end", index: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := newQueue()
+			queue.Add(testTracks(3)...)
+
+			played := ""
+			_, ok, err := queue.JumpAndPlay(tt.index, func(track lavalink.Track) error {
+				played = track.Info.Identifier
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || played != tt.played {
+				t.Fatalf("JumpAndPlay(%d) = %q, %v, want %q, %v", tt.index, played, ok, tt.played, tt.ok)
+			}
+			left := tt.left
+			if !ok {
+				left = trackNames(testTracks(3))
+			}
+			if got := trackNames(queue.Tracks()); fmt.Sprint(got) != fmt.Sprint(left) {
+				t.Errorf("queue is %v, want %v", got, left)
+			}
+		})
+	}
+
+	t.Run("failed play keeps the queue", func(t *testing.T) {
+		queue := newQueue()
+		queue.Add(testTracks(3)...)
+
+		if _, _, err := queue.JumpAndPlay(1, func(lavalink.Track) error { return errors.New("play failed") }); err == nil {
+			t.Fatal("JumpAndPlay returned no error")
+		}
+		if got, want := trackNames(queue.Tracks()), trackNames(testTracks(3)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("queue is %v, want %v", got, want)
+		}
+	})
+}
+
+func TestQueueAddBefore(t *testing.T) {
+	autoplay := withRequest(testTracks(3)[1:], TrackRequest{Autoplay: true})
+	requested := testTrack(3)
+
+	queue := newQueue()
+	queue.Add(testTrack(0))
+	queue.Add(autoplay...)
+	queue.AddBefore(isAutoplayTrack, requested)
+
+	want := []string{"track-0", "track-3", "track-1", "track-2"}
+	if got := trackNames(queue.Tracks()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("queue is %v, want %v", got, want)
+	}
+
+	// without autoplay tracks the tracks are added to the end
+	queue = newQueue()
+	queue.Add(testTrack(0))
+	queue.AddBefore(isAutoplayTrack, requested)
+
+	want = []string{"track-0", "track-3"}
+	if got := trackNames(queue.Tracks()); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("queue is %v, want %v", got, want)
+	}
+}
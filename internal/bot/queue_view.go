@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// amount of tracks shown per queue page
+const queuePageSize = 10
+
+func (h CmdHandler) queue(event *handler.CommandEvent) error {
+	embed, components := h.queueView(*event.GuildID(), 0)
+	return event.CreateMessage(discord.MessageCreate{
+		Embeds:     []discord.Embed{embed},
+		Components: components,
+	})
+}
+
+// switches the queue message to another page
+func (h CmdHandler) queuePage(event *handler.ComponentEvent) error {
+	page, err := strconv.Atoi(event.Variables["page"])
+	if err != nil {
+		page = 0
+	}
+
+	embed, components := h.queueView(*event.GuildID(), page)
+	return event.UpdateMessage(discord.MessageUpdate{
+		Embeds:     &[]discord.Embed{embed},
+		Components: &components,
+	})
+}
+
+// builds the embed and page buttons for a page of the guilds queue
+func (h CmdHandler) queueView(guildID snowflake.ID, page int) (discord.Embed, []discord.ContainerComponent) {
+	queue := h.musicBot.Queues.Get(guildID)
+	tracks := queue.Tracks()
+
+	pages := max((len(tracks)+queuePageSize-1)/queuePageSize, 1)
+	page = min(max(page, 0), pages-1)
+
+	var (
+		description strings.Builder
+		remaining   lavalink.Duration
+	)
+
+	// current track at the top
+	if player := h.musicBot.Lavalink.ExistingPlayer(guildID); player != nil && player.Track() != nil {
+		track := player.Track()
+		fmt.Fprintf(&description, "**Now playing:** %s `%s / %s`", formatTrack(*track), formatPosition(player.Position()), formatTrackLength(*track))
+		if requester := formatRequester(*track); requester != "" {
+			fmt.Fprintf(&description, " • %s", requester)
+		}
+		description.WriteString("\n\n")
+		if !track.Info.IsStream {
+			remaining += track.Info.Length - player.Position()
+		}
+	}
+
+	for _, track := range tracks {
+		if !track.Info.IsStream {
+			remaining += track.Info.Length
+		}
+	}
+
+	if len(tracks) == 0 {
+		description.WriteString("No tracks in queue")
+	}
+
+	start := page * queuePageSize
+	end := min(start+queuePageSize, len(tracks))
+	for i, track := range tracks[start:end] {
+		fmt.Fprintf(&description, "%d. %s `%s`", start+i+1, formatTrack(track), formatTrackLength(track))
+		if requester := formatRequester(track); requester != "" {
+			fmt.Fprintf(&description, " • %s", requester)
+		}
+		description.WriteString("\n")
+	}
+
+	autoplay := "off"
+	if h.musicBot.Autoplay.Enabled(guildID) {
+		autoplay = "on"
+	}
+
+	embed := discord.NewEmbedBuilder().
+		SetTitle("Queue").
+		SetDescription(description.String()).
+		SetFooterTextf("Page %d/%d • %d tracks • %s remaining • Loop: %s • Autoplay: %s", page+1, pages, len(tracks), formatPosition(remaining), queue.Type(), autoplay).
+		Build()
+
+	components := []discord.ContainerComponent{
+		discord.NewActionRow(
+			discord.NewSecondaryButton("Previous", fmt.Sprintf("/queue/page/%d", page-1)).WithDisabled(page == 0),
+			discord.NewSecondaryButton("Next", fmt.Sprintf("/queue/page/%d", page+1)).WithDisabled(page >= pages-1),
+		),
+	}
+
+	return embed, components
+}
+
+// formats the length of a track, streams have no length
+func formatTrackLength(track lavalink.Track) string {
+	if track.Info.IsStream {
+		return "LIVE"
+	}
+	return formatPosition(track.Info.Length)
+}
+
+// formats the title of a track as a link to it, tracks without uri only show their title
+func formatTrack(track lavalink.Track) string {
+	if track.Info.URI == nil {
+		return fmt.Sprintf("`%s`", track.Info.Title)
+	}
+	return fmt.Sprintf("[`%s`](<%s>)", track.Info.Title, *track.Info.URI)
+}
+
+// returns the uri of a track for logging, empty if it has none
+func trackURI(track lavalink.Track) string {
+	if track.Info.URI == nil {
+		return ""
+	}
+	return *track.Info.URI
+}
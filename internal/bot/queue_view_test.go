@@ -0,0 +1,27 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+)
+
+func TestFormatTrack(t *testing.T) {
+	uri := "https://example.com/track"
+	tests := []struct {
+		name string
+		uri  *string
+		want string
+	}{
+		{name: "with uri", uri: &uri, want: "[`Track`](<https://example.com/track>)"},
+		{name: "without uri", uri: nil, want: "`Track`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := lavalink.Track{Info: lavalink.TrackInfo{Title: "Track", URI: tt.uri}}
+			if got := formatTrack(track); got != tt.want {
+				t.Errorf("formatTrack() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// why a track failed to play
+type trackFailure struct {
+	track    lavalink.Track
+	reason   string
+	severity lavalink.Severity
+	// position the track failed at, a retry continues from there
+	position lavalink.Duration
+}
+
+// Recovery retries tracks which failed to play once, and skips them if they fail again
+type Recovery struct {
+	musicBot *MusicBot
+
+	mu sync.Mutex
+	// exceptions of each guild, handled once the failed track ended
+	failures map[snowflake.ID]trackFailure
+	// tracks retried in each guild since the last track finished normally
+	retried map[snowflake.ID]map[string]bool
+}
+
+func newRecovery(musicBot *MusicBot) *Recovery {
+	return &Recovery{
+		musicBot: musicBot,
+		failures: make(map[snowflake.ID]trackFailure),
+		retried:  make(map[snowflake.ID]map[string]bool),
+	}
+}
+
+// remembers the exception of a track until lavalink ends it
+func (r *Recovery) Failed(guildID snowflake.ID, failure trackFailure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures[guildID] = failure
+}
+
+// returns the exception of the ended track, or an unknown failure if there was none
+func (r *Recovery) takeFailure(guildID snowflake.ID, track lavalink.Track) trackFailure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failure, ok := r.failures[guildID]
+	delete(r.failures, guildID)
+	if !ok || trackKey(failure.track) != trackKey(track) {
+		return trackFailure{track: track, reason: "unknown error", severity: lavalink.SeverityFault}
+	}
+	return failure
+}
+
+// forgets the retried tracks of the guild, called when a track played to its end
+func (r *Recovery) Reset(guildID snowflake.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, guildID)
+	delete(r.retried, guildID)
+}
+
+// marks the tracks as retried, returns false if one of them was retried already
+func (r *Recovery) markRetried(guildID snowflake.ID, tracks ...lavalink.Track) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	retried, ok := r.retried[guildID]
+	if !ok {
+		retried = make(map[string]bool)
+		r.retried[guildID] = retried
+	}
+	for _, track := range tracks {
+		if retried[trackKey(track)] {
+			return false
+		}
+	}
+	for _, track := range tracks {
+		retried[trackKey(track)] = true
+	}
+	return true
+}
+
+// retries the failed track if it wasn't retried yet and tells the guild about the failure.
+// the retry runs in the background, as looking up an alternate track mustn't block the lavalink event listeners.
+// skip is called if the track isn't retried.
+func (r *Recovery) Recover(player disgolink.Player, failure trackFailure, skip func()) {
+	guildID := player.GuildID()
+	title := failure.track.Info.Title
+
+	logger.Warn("track failed to play",
+		slog.String("guild.id", guildID.String()),
+		slog.String("title", title),
+		slog.String("reason", failure.reason),
+		slog.String("severity", string(failure.severity)),
+	)
+
+	go func() {
+		if r.retry(player, failure) {
+			return
+		}
+		r.musicBot.Announcer.Notify(guildID, fmt.Sprintf("Couldn't play `%s` (%s): %s\nSkipping it", title, failure.severity, failure.reason))
+		skip()
+	}()
+}
+
+// plays the failed track or an alternate of it again, reports whether it was retried
+func (r *Recovery) retry(player disgolink.Player, failure trackFailure) bool {
+	guildID := player.GuildID()
+	title := failure.track.Info.Title
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	retry, position := r.retryTrack(ctx, guildID, failure)
+	if retry.Info.IsStream {
+		position = 0
+	}
+	if !r.markRetried(guildID, failure.track, retry) {
+		return false
+	}
+
+	if err := player.Update(ctx, lavalink.WithTrack(retry), lavalink.WithPosition(position)); err != nil {
+		msg := "error while retrying track"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		return false
+	}
+
+	msg := fmt.Sprintf("Couldn't play `%s` (%s): %s\nRetrying once", title, failure.severity, failure.reason)
+	if trackKey(retry) != trackKey(failure.track) {
+		msg = fmt.Sprintf("Couldn't play `%s` (%s): %s\nTrying %s instead", title, failure.severity, failure.reason, formatTrack(retry))
+	}
+	r.musicBot.Announcer.Notify(guildID, msg)
+	return true
+}
+
+// returns the track to retry and the position to start it at.
+// with recovery.alternate the track is searched again by its isrc or title, so another copy of it is played.
+func (r *Recovery) retryTrack(ctx context.Context, guildID snowflake.ID, failure trackFailure) (lavalink.Track, lavalink.Duration) {
+	if !k.Bool("recovery.alternate") {
+		return failure.track, failure.position
+	}
+
+	query := failure.track.Info.Author + " " + failure.track.Info.Title
+	if failure.track.Info.ISRC != nil && *failure.track.Info.ISRC != "" {
+		query = *failure.track.Info.ISRC
+	}
+
+	results, err := r.musicBot.loadTracks(ctx, guildID, query)
+	if err != nil || len(results) == 0 || trackKey(results[0]) == trackKey(failure.track) {
+		logger.Debug("no alternate track found, retrying the same track", slog.String("query", query))
+		return failure.track, failure.position
+	}
+
+	// keep the requester of the failed track
+	alternate := results[0]
+	alternate.UserData = failure.track.UserData
+	return alternate, 0
+}
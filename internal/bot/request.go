@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// TrackRequest describes who requested a track and where.
+// It is stored in the user data of the track, so lavalink hands it back with every track event.
+type TrackRequest struct {
+	// user who requested the track
+	UserID snowflake.ID `json:"user_id"`
+	// text channel the track was requested in
+	ChannelID snowflake.ID `json:"channel_id"`
+	// interaction the track was requested with
+	InteractionID snowflake.ID `json:"interaction_id"`
+	RequestedAt   time.Time    `json:"requested_at"`
+	// whether autoplay queued the track instead of a user
+	Autoplay bool `json:"autoplay,omitempty"`
+}
+
+// returns a copy of the tracks with the request attached
+func withRequest(tracks []lavalink.Track, request TrackRequest) []lavalink.Track {
+	requested := make([]lavalink.Track, 0, len(tracks))
+	for _, track := range tracks {
+		if withData, err := track.WithUserData(request); err == nil {
+			track = withData
+		}
+		requested = append(requested, track)
+	}
+	return requested
+}
+
+// returns the request attached to the track, if any
+func trackRequest(track lavalink.Track) (TrackRequest, bool) {
+	var request TrackRequest
+	if len(track.UserData) == 0 {
+		return request, false
+	}
+	if err := track.UserData.Unmarshal(&request); err != nil || (request.UserID == 0 && !request.Autoplay) {
+		return request, false
+	}
+	return request, true
+}
+
+// reports whether autoplay queued the track
+func isAutoplayTrack(track lavalink.Track) bool {
+	request, ok := trackRequest(track)
+	return ok && request.Autoplay
+}
+
+// formats who requested the track, empty if unknown
+func formatRequester(track lavalink.Track) string {
+	request, ok := trackRequest(track)
+	if !ok {
+		return ""
+	}
+	if request.Autoplay {
+		return "Autoplay"
+	}
+	return fmt.Sprintf("<@%s>", request.UserID)
+}
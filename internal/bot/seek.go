@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/rotisserie/eris"
+)
+
+// longest timestamp parseTimestamp accepts, so adding it to a position can't overflow
+const maxTimestamp = lavalink.Duration(math.MaxInt32) * lavalink.Second
+
+// parses a timestamp like "1:23" or "1:02:03", a duration like "1h2m3s" or plain seconds like "83"
+func parseTimestamp(s string) (lavalink.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, eris.New("empty timestamp")
+	}
+
+	// plain seconds
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return 0, eris.Errorf("invalid timestamp %q", s)
+		}
+		if seconds < 0 {
+			return 0, eris.New("timestamp must not be negative")
+		}
+		// converting floats which don't fit into a duration is undefined
+		if seconds > float64(maxTimestamp.Seconds()) {
+			return 0, eris.Errorf("timestamp %q is too long", s)
+		}
+		return lavalink.Duration(seconds * float64(lavalink.Second)), nil
+	}
+
+	// h:m:s or m:s
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, eris.Errorf("invalid timestamp %q", s)
+		}
+
+		var total lavalink.Duration
+		for i, part := range parts {
+			value, err := strconv.Atoi(part)
+			if err != nil || value < 0 {
+				return 0, eris.Errorf("invalid timestamp %q", s)
+			}
+			// everything but the first part must be below 60
+			if i > 0 && value >= 60 {
+				return 0, eris.Errorf("invalid timestamp %q", s)
+			}
+			if value > int(maxTimestamp.Seconds()) {
+				return 0, eris.Errorf("timestamp %q is too long", s)
+			}
+			total = total*60 + lavalink.Duration(value)*lavalink.Second
+			if total > maxTimestamp {
+				return 0, eris.Errorf("timestamp %q is too long", s)
+			}
+		}
+		return total, nil
+	}
+
+	// go duration like 1h2m3s
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, eris.Errorf("invalid timestamp %q", s)
+	}
+	if duration < 0 {
+		return 0, eris.New("timestamp must not be negative")
+	}
+	if lavalink.Duration(duration.Milliseconds()) > maxTimestamp {
+		return 0, eris.Errorf("timestamp %q is too long", s)
+	}
+	return lavalink.Duration(duration.Milliseconds()), nil
+}
+
+// moves the guilds player to the position returned by target
+func (h CmdHandler) seekTo(event *handler.CommandEvent, target func(position lavalink.Duration) lavalink.Duration) error {
+	player := h.musicBot.Lavalink.ExistingPlayer(*event.GuildID())
+	if player == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No player found",
+		})
+	}
+
+	track := player.Track()
+	if track == nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "No track found",
+		})
+	}
+	if track.Info.IsStream {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: "Livestreams can't be seeked",
+		})
+	}
+
+	// rewinding past the start goes back to the start
+	position := max(target(player.Position()), 0)
+	if position > track.Info.Length {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Position must be within `0:00`-`%s`", formatPosition(track.Info.Length)),
+		})
+	}
+
+	if err := player.Update(context.TODO(), lavalink.WithPosition(position)); err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while seeking: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content: fmt.Sprintf("Seeked to `%s / %s`", formatPosition(position), formatPosition(track.Info.Length)),
+	})
+}
+
+// parses the timestamp option of a seek command, responding to the user if it is invalid
+func timestampOption(event *handler.CommandEvent, name string) (lavalink.Duration, bool, error) {
+	timestamp, err := parseTimestamp(event.SlashCommandInteractionData().String(name))
+	if err != nil {
+		return 0, false, event.CreateMessage(discord.MessageCreate{
+			Content: "Time must look like `1:23`, `1h2m3s` or `83`",
+		})
+	}
+	return timestamp, true, nil
+}
+
+func (h CmdHandler) seek(event *handler.CommandEvent) error {
+	logger.Info("Received /seek command")
+
+	timestamp, ok, err := timestampOption(event, "position")
+	if !ok {
+		return err
+	}
+	return h.seekTo(event, func(lavalink.Duration) lavalink.Duration {
+		return timestamp
+	})
+}
+
+func (h CmdHandler) forward(event *handler.CommandEvent) error {
+	logger.Info("Received /forward command")
+
+	offset, ok, err := timestampOption(event, "time")
+	if !ok {
+		return err
+	}
+	return h.seekTo(event, func(position lavalink.Duration) lavalink.Duration {
+		return position + offset
+	})
+}
+
+func (h CmdHandler) rewind(event *handler.CommandEvent) error {
+	logger.Info("Received /rewind command")
+
+	offset, ok, err := timestampOption(event, "time")
+	if !ok {
+		return err
+	}
+	return h.seekTo(event, func(position lavalink.Duration) lavalink.Duration {
+		return position - offset
+	})
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    lavalink.Duration
+		wantErr bool
+	}{
+		// h:m:s and m:s
+		{input: "1:02:03", want: lavalink.Hour + 2*lavalink.Minute + 3*lavalink.Second},
+		{input: "1:23", want: lavalink.Minute + 23*lavalink.Second},
+		{input: "0:00", want: 0},
+		{input: "90:00", want: 90 * lavalink.Minute},
+		{input: " 1:23 ", want: lavalink.Minute + 23*lavalink.Second},
+		{input: "1:60", wantErr: true},
+		{input: "1:00:60", wantErr: true},
+		{input: "1:2:3:4", wantErr: true},
+		{input: "1:-2", wantErr: true},
+		{input: "1:", wantErr: true},
+		{input: ":30", wantErr: true},
+		{input: "a:30", wantErr: true},
+		{input: "99999999999999:00", wantErr: true},
+
+		// plain seconds
+		{input: "90", want: 90 * lavalink.Second},
+		{input: "0", want: 0},
+		{input: "-0", want: 0},
+		{input: "1.5", want: 1500 * lavalink.Millisecond},
+		{input: "-5", wantErr: true},
+		{input: "NaN", wantErr: true},
+		{input: "Inf", wantErr: true},
+		{input: "-Inf", wantErr: true},
+		{input: "1e300", wantErr: true},
+		{input: "1e3", want: 1000 * lavalink.Second},
+
+		// go durations
+		{input: "1h2m3s", want: lavalink.Hour + 2*lavalink.Minute + 3*lavalink.Second},
+		{input: "90s", want: 90 * lavalink.Second},
+		{input: "1m30s", want: 90 * lavalink.Second},
+		{input: "500ms", want: 500 * lavalink.Millisecond},
+		{input: "-1m", wantErr: true},
+		{input: "2000000h", wantErr: true},
+
+		// garbage
+		{input: "", wantErr: true},
+		{input: "   ", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "1h2x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseTimestamp(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimestamp(%q) = %d, error %v, want error %v", tt.input, got, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("parseTimestamp(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+			if err == nil && (got < 0 || got > maxTimestamp) {
+				t.Errorf("parseTimestamp(%q) = %d, outside of 0 to maxTimestamp", tt.input, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// settings of a single guild, zero values fall back to the global config
+type GuildSettings struct {
+	GuildID snowflake.ID `json:"guild_id"`
+
+	// volume new players start with
+	DefaultVolume int `json:"default_volume,omitempty"`
+	// search type used by /play for plain queries, e.g. "ytsearch"
+	SearchSource string `json:"search_source,omitempty"`
+	// text channel now playing messages are posted in, instead of the channel the session was started from
+	AnnounceChannelID snowflake.ID `json:"announce_channel_id,omitempty"`
+	// turns now playing messages off
+	AnnounceDisabled bool `json:"announce_disabled,omitempty"`
+	// role needed to control the player, everyone is a DJ if unset
+	DJRoleID snowflake.ID `json:"dj_role_id,omitempty"`
+	// maximum amount of tracks in the queue
+	MaxQueueLength int `json:"max_queue_length,omitempty"`
+	// maximum length of a track
+	MaxTrackDuration lavalink.Duration `json:"max_track_duration,omitempty"`
+	// how long to stay in the voice channel with nothing playing
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	// lavalink source names tracks may come from, all are allowed if empty
+	AllowedSources []string `json:"allowed_sources,omitempty"`
+	// lavalink source names tracks may not come from
+	BlockedSources []string `json:"blocked_sources,omitempty"`
+	// whether to play related tracks when the queue runs out
+	Autoplay bool `json:"autoplay,omitempty"`
+}
+
+// SettingsStore persists the settings of every guild
+type SettingsStore interface {
+	// loads the settings of a guild, returns empty settings if there are none
+	Get(ctx context.Context, guildID snowflake.ID) (GuildSettings, error)
+	// saves the settings of a guild, replacing any existing settings
+	Save(ctx context.Context, settings GuildSettings) error
+}
+
+// FileSettingsStore stores the settings of every guild as a json file in a directory
+type FileSettingsStore struct {
+	files fileStore
+}
+
+func NewFileSettingsStore(dir string) *FileSettingsStore {
+	return &FileSettingsStore{
+		files: fileStore{dir: dir},
+	}
+}
+
+func (s *FileSettingsStore) Get(_ context.Context, guildID snowflake.ID) (GuildSettings, error) {
+	settings := GuildSettings{GuildID: guildID}
+	if err := s.files.read(guildID.String(), &settings); err != nil && !eris.Is(err, os.ErrNotExist) {
+		return settings, err
+	}
+	return settings, nil
+}
+
+func (s *FileSettingsStore) Save(_ context.Context, settings GuildSettings) error {
+	return s.files.write(settings.GuildID.String(), settings)
+}
+
+// SettingsManager caches the settings of every guild in front of a SettingsStore
+type SettingsManager struct {
+	store SettingsStore
+
+	mu       sync.Mutex
+	settings map[snowflake.ID]GuildSettings
+
+	// held by Update from reading to saving the settings, so concurrent updates don't lose each other's changes.
+	// it's separate from mu, so reading settings doesn't wait for a save.
+	updateMu sync.Mutex
+}
+
+func NewSettingsManager(store SettingsStore) *SettingsManager {
+	return &SettingsManager{
+		store:    store,
+		settings: make(map[snowflake.ID]GuildSettings),
+	}
+}
+
+// returns the settings of the guild
+func (m *SettingsManager) Get(guildID snowflake.ID) GuildSettings {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if settings, ok := m.settings[guildID]; ok {
+		return settings
+	}
+
+	settings, err := m.store.Get(context.TODO(), guildID)
+	if err != nil {
+		msg := "error while loading guild settings"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)))
+		// don't cache, so loading is tried again next time
+		return GuildSettings{GuildID: guildID}
+	}
+	m.settings[guildID] = settings
+	return settings
+}
+
+// changes the settings of the guild and persists them
+func (m *SettingsManager) Update(guildID snowflake.ID, update func(settings *GuildSettings)) error {
+	m.updateMu.Lock()
+	defer m.updateMu.Unlock()
+
+	// the cached settings share their slices, don't let update change them in place
+	settings := m.Get(guildID)
+	settings.AllowedSources = slices.Clone(settings.AllowedSources)
+	settings.BlockedSources = slices.Clone(settings.BlockedSources)
+	update(&settings)
+
+	if err := m.store.Save(context.TODO(), settings); err != nil {
+		return eris.Wrap(err, "error while saving guild settings")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.settings[guildID] = settings
+	return nil
+}
+
+// returns the idle timeout of the guild
+func (s GuildSettings) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return k.Duration("idle.timeout")
+}
+
+// names of the settings which can be reset
+const (
+	settingDefaultVolume    = "default-volume"
+	settingSearchSource     = "search-source"
+	settingAnnounceChannel  = "announce-channel"
+	settingAnnouncements    = "announcements"
+	settingDJRole           = "dj-role"
+	settingMaxQueueLength   = "max-queue-length"
+	settingMaxTrackDuration = "max-track-duration"
+	settingIdleTimeout      = "idle-timeout"
+	settingAllowedSources   = "allowed-sources"
+	settingBlockedSources   = "blocked-sources"
+	settingAutoplay         = "autoplay"
+)
+
+// resets a single setting of the guild to the global config
+var settingResets = map[string]func(settings *GuildSettings){
+	settingDefaultVolume:    func(s *GuildSettings) { s.DefaultVolume = 0 },
+	settingSearchSource:     func(s *GuildSettings) { s.SearchSource = "" },
+	settingAnnounceChannel:  func(s *GuildSettings) { s.AnnounceChannelID = 0 },
+	settingAnnouncements:    func(s *GuildSettings) { s.AnnounceDisabled = false },
+	settingDJRole:           func(s *GuildSettings) { s.DJRoleID = 0 },
+	settingMaxQueueLength:   func(s *GuildSettings) { s.MaxQueueLength = 0 },
+	settingMaxTrackDuration: func(s *GuildSettings) { s.MaxTrackDuration = 0 },
+	settingIdleTimeout:      func(s *GuildSettings) { s.IdleTimeout = 0 },
+	settingAllowedSources:   func(s *GuildSettings) { s.AllowedSources = nil },
+	settingBlockedSources:   func(s *GuildSettings) { s.BlockedSources = nil },
+	settingAutoplay:         func(s *GuildSettings) { s.Autoplay = false },
+}
+
+// builds the embed showing the settings of the guild
+func settingsEmbed(settings GuildSettings) discord.Embed {
+	orDefault := func(set bool, value string) string {
+		if !set {
+			return "Default"
+		}
+		return value
+	}
+
+	announcements := "On"
+	if settings.AnnounceDisabled {
+		announcements = "Off"
+	}
+	autoplay := "Off"
+	if settings.Autoplay {
+		autoplay = "On"
+	}
+
+	return discord.NewEmbedBuilder().
+		SetTitle("Settings").
+		AddField("Default volume", orDefault(settings.DefaultVolume > 0, fmt.Sprintf("%d%%", settings.DefaultVolume)), true).
+		AddField("Search source", orDefault(settings.SearchSource != "", fmt.Sprintf("`%s`", settings.SearchSource)), true).
+		AddField("Announce channel", orDefault(settings.AnnounceChannelID != 0, discord.ChannelMention(settings.AnnounceChannelID)), true).
+		AddField("Announcements", announcements, true).
+		AddField("DJ role", orDefault(settings.DJRoleID != 0, discord.RoleMention(settings.DJRoleID)), true).
+		AddField("Max queue length", orDefault(settings.MaxQueueLength > 0, fmt.Sprintf("%d tracks", settings.MaxQueueLength)), true).
+		AddField("Max track duration", orDefault(settings.MaxTrackDuration > 0, formatPosition(settings.MaxTrackDuration)), true).
+		AddField("Idle timeout", orDefault(settings.IdleTimeout > 0, settings.IdleTimeout.String()), true).
+		AddField("Allowed sources", orDefault(len(settings.AllowedSources) > 0, "`"+strings.Join(settings.AllowedSources, "`, `")+"`"), true).
+		AddField("Blocked sources", orDefault(len(settings.BlockedSources) > 0, "`"+strings.Join(settings.BlockedSources, "`, `")+"`"), true).
+		AddField("Autoplay", autoplay, true).
+		Build()
+}
+
+func (h CmdHandler) settingsView(event *handler.CommandEvent) error {
+	logger.Info("Received /settings view command")
+
+	return event.CreateMessage(discord.MessageCreate{
+		Embeds:          []discord.Embed{settingsEmbed(h.musicBot.Settings.Get(*event.GuildID()))},
+		AllowedMentions: &discord.AllowedMentions{},
+	})
+}
+
+func (h CmdHandler) settingsSet(event *handler.CommandEvent) error {
+	logger.Info("Received /settings set command")
+
+	data := event.SlashCommandInteractionData()
+
+	// parse the durations first, so nothing is saved if one is invalid
+	var maxTrackDuration, idleTimeout lavalink.Duration
+	for name, duration := range map[string]*lavalink.Duration{
+		settingMaxTrackDuration: &maxTrackDuration,
+		settingIdleTimeout:      &idleTimeout,
+	} {
+		value, ok := data.OptString(name)
+		if !ok {
+			continue
+		}
+		parsed, err := parseTimestamp(value)
+		if err != nil || parsed <= 0 {
+			return event.CreateMessage(discord.MessageCreate{
+				Content: fmt.Sprintf("`%s` must look like `1:23`, `1h2m3s` or `83`", name),
+			})
+		}
+		*duration = parsed
+	}
+
+	err := h.musicBot.Settings.Update(*event.GuildID(), func(settings *GuildSettings) {
+		if volume, ok := data.OptInt(settingDefaultVolume); ok {
+			settings.DefaultVolume = volume
+		}
+		if source, ok := data.OptString(settingSearchSource); ok {
+			settings.SearchSource = source
+		}
+		if channel, ok := data.OptChannel(settingAnnounceChannel); ok {
+			settings.AnnounceChannelID = channel.ID
+		}
+		if enabled, ok := data.OptBool(settingAnnouncements); ok {
+			settings.AnnounceDisabled = !enabled
+		}
+		if role, ok := data.OptRole(settingDJRole); ok {
+			settings.DJRoleID = role.ID
+		}
+		if length, ok := data.OptInt(settingMaxQueueLength); ok {
+			settings.MaxQueueLength = length
+		}
+		if maxTrackDuration > 0 {
+			settings.MaxTrackDuration = maxTrackDuration
+		}
+		if idleTimeout > 0 {
+			settings.IdleTimeout = time.Duration(idleTimeout.Milliseconds()) * time.Millisecond
+		}
+		if sources, ok := data.OptString(settingAllowedSources); ok {
+			settings.AllowedSources = parseSources(sources)
+		}
+		if sources, ok := data.OptString(settingBlockedSources); ok {
+			settings.BlockedSources = parseSources(sources)
+		}
+		if enabled, ok := data.OptBool(settingAutoplay); ok {
+			settings.Autoplay = enabled
+		}
+	})
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while saving settings: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content:         "Settings saved",
+		Embeds:          []discord.Embed{settingsEmbed(h.musicBot.Settings.Get(*event.GuildID()))},
+		AllowedMentions: &discord.AllowedMentions{},
+	})
+}
+
+func (h CmdHandler) settingsReset(event *handler.CommandEvent) error {
+	logger.Info("Received /settings reset command")
+
+	name, ok := event.SlashCommandInteractionData().OptString("setting")
+	err := h.musicBot.Settings.Update(*event.GuildID(), func(settings *GuildSettings) {
+		// reset everything if no setting is given
+		if !ok {
+			*settings = GuildSettings{GuildID: settings.GuildID}
+			return
+		}
+		if reset, exists := settingResets[name]; exists {
+			reset(settings)
+		}
+	})
+	if err != nil {
+		return event.CreateMessage(discord.MessageCreate{
+			Content: fmt.Sprintf("Error while saving settings: `%s`", err),
+		})
+	}
+
+	return event.CreateMessage(discord.MessageCreate{
+		Content:         "Settings reset",
+		Embeds:          []discord.Embed{settingsEmbed(h.musicBot.Settings.Get(*event.GuildID()))},
+		AllowedMentions: &discord.AllowedMentions{},
+	})
+}
+
+// parses a comma separated list of lavalink source names
+func parseSources(s string) []string {
+	var sources []string
+	for _, source := range strings.Split(s, ",") {
+		source = strings.ToLower(strings.TrimSpace(source))
+		if source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
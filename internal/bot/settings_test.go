@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestSettingsManagerConcurrentUpdates(t *testing.T) {
+	store := NewFileSettingsStore(t.TempDir())
+	manager := NewSettingsManager(store)
+	guildID := snowflake.ID(1)
+
+	// every worker sets another field, none of them may get lost
+	var wg sync.WaitGroup
+	for w := 0; w < testWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			err := manager.Update(guildID, func(settings *GuildSettings) {
+				switch w % 4 {
+				case 0:
+					settings.DJRoleID = 50
+				case 1:
+					settings.AnnounceChannelID = 60
+				case 2:
+					settings.DefaultVolume = 70
+				case 3:
+					settings.BlockedSources = append(settings.BlockedSources, "youtube")
+				}
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	check := func(name string, settings GuildSettings) {
+		t.Helper()
+		if settings.DJRoleID != 50 || settings.AnnounceChannelID != 60 || settings.DefaultVolume != 70 {
+			t.Errorf("%s settings lost an update: %+v", name, settings)
+		}
+		if len(settings.BlockedSources) != testWorkers/4 {
+			t.Errorf("%s settings have %d blocked sources, want %d", name, len(settings.BlockedSources), testWorkers/4)
+		}
+	}
+	check("cached", manager.Get(guildID))
+
+	saved, err := store.Get(context.Background(), guildID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("saved", saved)
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// source of search prefixes, named like the source names lavalink reports for tracks
+var searchPrefixSources = map[string]string{
+	"ytsearch":  "youtube",
+	"ytmsearch": "youtube",
+	"scsearch":  "soundcloud",
+	"dzsearch":  "deezer",
+	"dzisrc":    "deezer",
+	"spsearch":  "spotify",
+	"amsearch":  "applemusic",
+}
+
+// source of link hosts, subdomains are matched as well
+var hostSources = map[string]string{
+	"youtube.com":      "youtube",
+	"youtu.be":         "youtube",
+	"soundcloud.com":   "soundcloud",
+	"deezer.com":       "deezer",
+	"deezer.page.link": "deezer",
+	"spotify.com":      "spotify",
+	"music.apple.com":  "applemusic",
+	"bandcamp.com":     "bandcamp",
+	"twitch.tv":        "twitch",
+	"vimeo.com":        "vimeo",
+}
+
+// returns the source an identifier is loaded from.
+// links to unknown hosts are played by the http source, identifiers without a known prefix are treated as local.
+func identifierSource(identifier string) string {
+	if urlPattern.MatchString(identifier) {
+		u, err := url.Parse(identifier)
+		if err != nil {
+			return "http"
+		}
+		host := strings.ToLower(u.Hostname())
+		for suffix, source := range hostSources {
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return source
+			}
+		}
+		return "http"
+	}
+
+	if prefix, _, ok := strings.Cut(identifier, ":"); ok {
+		if source, ok := searchPrefixSources[prefix]; ok {
+			return source
+		}
+	}
+	return "local"
+}
+
+// returns the search type /play uses for identifiers without a link or prefix
+func (b *MusicBot) searchType(guildID snowflake.ID) lavalink.SearchType {
+	if source := b.Settings.Get(guildID).SearchSource; source != "" {
+		return lavalink.SearchType(source)
+	}
+	return lavalink.SearchType(k.String("play.search.source"))
+}
+
+// reports whether tracks may be played from the source in the guild.
+// sources blocked by play.sources.blocked or the guild settings are never allowed,
+// if the guild has allowed sources only those are.
+func (b *MusicBot) sourceAllowed(guildID snowflake.ID, source string) bool {
+	if slices.Contains(parseSources(k.String("play.sources.blocked")), source) {
+		return false
+	}
+
+	settings := b.Settings.Get(guildID)
+	if slices.Contains(settings.BlockedSources, source) {
+		return false
+	}
+	return len(settings.AllowedSources) == 0 || slices.Contains(settings.AllowedSources, source)
+}
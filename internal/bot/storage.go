@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+// persisted state of a guilds queue and player
+type QueueState struct {
+	GuildID snowflake.ID `json:"guild_id"`
+	// voice channel the bot was connected to
+	ChannelID snowflake.ID     `json:"channel_id"`
+	Type      QueueType        `json:"type"`
+	Tracks    []lavalink.Track `json:"tracks"`
+
+	// currently playing track, nil if nothing is playing
+	Current  *lavalink.Track   `json:"current,omitempty"`
+	Position lavalink.Duration `json:"position"`
+	Paused   bool              `json:"paused"`
+	Volume   int               `json:"volume"`
+
+	// text channel now playing messages are posted in
+	AnnounceChannelID snowflake.ID `json:"announce_channel_id,omitempty"`
+}
+
+// QueueStore persists queues, so they survive restarts of the bot
+type QueueStore interface {
+	// saves the state of a guilds queue, replacing any existing state
+	Save(ctx context.Context, state QueueState) error
+	// deletes the state of a guilds queue
+	Delete(ctx context.Context, guildID snowflake.ID) error
+	// loads the state of all stored queues
+	LoadAll(ctx context.Context) ([]QueueState, error)
+}
+
+// fileStore stores json documents as files in a directory
+type fileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func (s *fileStore) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *fileStore) write(name string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return eris.Wrap(err, "error while creating storage directory")
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return eris.Wrap(err, "error while encoding document")
+	}
+
+	// write to a temporary file first, so a crash never leaves a half written document
+	tmp := s.path(name) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return eris.Wrap(err, "error while writing document")
+	}
+	if err = os.Rename(tmp, s.path(name)); err != nil {
+		return eris.Wrap(err, "error while replacing document")
+	}
+	return nil
+}
+
+func (s *fileStore) read(name string, v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return eris.Wrap(err, "error while reading document")
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return eris.Wrap(err, "error while decoding document")
+	}
+	return nil
+}
+
+func (s *fileStore) remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.path(name)); err != nil && !eris.Is(err, os.ErrNotExist) {
+		return eris.Wrap(err, "error while deleting document")
+	}
+	return nil
+}
+
+// renames a document which can't be read, so it isn't loaded again but can still be inspected
+func (s *fileStore) moveAside(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(s.path(name), s.path(name)+".broken"); err != nil {
+		return eris.Wrap(err, "error while moving document aside")
+	}
+	return nil
+}
+
+// returns the names of all stored documents
+func (s *fileStore) list() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if eris.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, eris.Wrap(err, "error while listing storage directory")
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names, nil
+}
+
+// FileQueueStore stores every queue as a json file in a directory
+type FileQueueStore struct {
+	files fileStore
+}
+
+func NewFileQueueStore(dir string) *FileQueueStore {
+	return &FileQueueStore{
+		files: fileStore{dir: dir},
+	}
+}
+
+func (s *FileQueueStore) Save(_ context.Context, state QueueState) error {
+	return s.files.write(state.GuildID.String(), state)
+}
+
+func (s *FileQueueStore) Delete(_ context.Context, guildID snowflake.ID) error {
+	return s.files.remove(guildID.String())
+}
+
+func (s *FileQueueStore) LoadAll(_ context.Context) ([]QueueState, error) {
+	names, err := s.files.list()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]QueueState, 0, len(names))
+	for _, name := range names {
+		var state QueueState
+		if err = s.files.read(name, &state); err != nil {
+			// a single broken queue shouldn't keep the other guilds from getting theirs back
+			msg := "error while loading queue, skipping it"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("file", s.files.path(name)))
+			if err = s.files.moveAside(name); err != nil {
+				logger.Error("error while moving broken queue aside", tint.Err(err), slog.String("file", s.files.path(name)))
+			}
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
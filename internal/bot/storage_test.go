@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestFileQueueStoreLoadAllSkipsBrokenFiles(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileQueueStore(dir)
+	ctx := context.Background()
+
+	for _, guildID := range []snowflake.ID{1, 2} {
+		if err := store.Save(ctx, QueueState{GuildID: guildID, Type: QueueTypeNormal, Tracks: testTracks(2)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "3.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := store.LoadAll(ctx)
+	if err != nil {
+		t.Fatalf("LoadAll failed because of one broken file: %s", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("loaded %d queues, want 2", len(states))
+	}
+	for _, state := range states {
+		if len(state.Tracks) != 2 {
+			t.Errorf("queue of %s has %d tracks, want 2", state.GuildID, len(state.Tracks))
+		}
+	}
+
+	// the broken file is kept for inspection, but not loaded again
+	if _, err = os.Stat(filepath.Join(dir, "3.json.broken")); err != nil {
+		t.Errorf("broken file wasn't moved aside: %s", err)
+	}
+	if states, err = store.LoadAll(ctx); err != nil || len(states) != 2 {
+		t.Errorf("second LoadAll = %d queues, %v, want 2 queues", len(states), err)
+	}
+}
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/lmittmann/tint"
+	"github.com/rotisserie/eris"
+)
+
+const (
+	// how long to wait for discord to tell where the bot went after it was disconnected
+	voiceSettleDelay = 2 * time.Second
+	// reconnects per guild within voiceReconnectWindow before giving up
+	voiceReconnectLimit  = 3
+	voiceReconnectWindow = time.Minute
+)
+
+// what to do after discord closed the voice connection of a player
+type voiceCloseAction string
+
+const (
+	// closed by us, e.g. when leaving
+	voiceCloseIgnore voiceCloseAction = "ignore"
+	// the connection dropped or the voice server moved, send lavalink the voice server again
+	voiceCloseResume voiceCloseAction = "resume"
+	// the voice session is gone, join the channel again to get a new one
+	voiceCloseRejoin voiceCloseAction = "rejoin"
+	// the bot was kicked, moved or the channel was deleted
+	voiceCloseDisconnected voiceCloseAction = "disconnected"
+	// the connection can't be recovered, leave the channel
+	voiceCloseFatal voiceCloseAction = "fatal"
+)
+
+// decides how to handle a closed voice connection based on its discord voice close code
+func voiceCloseActionFor(event lavalink.WebSocketClosedEvent) voiceCloseAction {
+	switch event.Code {
+	case 1000:
+		if !event.ByRemote {
+			return voiceCloseIgnore
+		}
+		return voiceCloseResume
+	// going away, abnormal closure, unknown error and voice server crashed
+	case 1001, 1006, 4000, 4015:
+		return voiceCloseResume
+	// session no longer valid and session timeout
+	case 4006, 4009:
+		return voiceCloseRejoin
+	// disconnected and call terminated
+	case 4014, 4022:
+		return voiceCloseDisconnected
+	default:
+		return voiceCloseFatal
+	}
+}
+
+// VoiceRecovery reconnects players whose voice connection was closed
+type VoiceRecovery struct {
+	musicBot *MusicBot
+
+	mu sync.Mutex
+	// positions to resume players at once their new voice server is known
+	resumes map[snowflake.ID]lavalink.Duration
+	// recent reconnects of each guild, to give up on connections which keep failing
+	reconnects *rateLimiter
+}
+
+func newVoiceRecovery(musicBot *MusicBot) *VoiceRecovery {
+	return &VoiceRecovery{
+		musicBot:   musicBot,
+		resumes:    make(map[snowflake.ID]lavalink.Duration),
+		reconnects: newRateLimiter(),
+	}
+}
+
+// handles a closed voice connection of the player
+func (v *VoiceRecovery) OnClosed(player disgolink.Player, event lavalink.WebSocketClosedEvent) {
+	guildID := event.GuildID()
+	action := v.action(event)
+
+	attrs := []any{
+		slog.String("guild.id", guildID.String()),
+		slog.Int("code", event.Code),
+		slog.String("reason", event.Reason),
+		slog.Bool("by_remote", event.ByRemote),
+		slog.String("action", string(action)),
+	}
+
+	switch action {
+	case voiceCloseIgnore:
+		logger.Debug("voice connection closed", attrs...)
+
+	case voiceCloseResume:
+		logger.Warn("voice connection closed, resuming", attrs...)
+		v.resume(player)
+
+	case voiceCloseRejoin:
+		logger.Warn("voice session closed, rejoining", attrs...)
+		v.rejoin(player)
+
+	case voiceCloseDisconnected:
+		logger.Info("disconnected from voice", attrs...)
+		// the voice state update telling whether the bot was moved or kicked may still be on its way
+		time.AfterFunc(voiceSettleDelay, func() {
+			v.checkDisconnected(guildID)
+		})
+
+	case voiceCloseFatal:
+		logger.Error("voice connection closed and can't be recovered, leaving", attrs...)
+		v.musicBot.Announcer.Notify(guildID, fmt.Sprintf("Lost the voice connection (`%d`: %s), leaving the voice channel", event.Code, event.Reason))
+		if err := v.musicBot.Client.UpdateVoiceState(context.TODO(), guildID, nil, false, false); err != nil {
+			msg := "error while leaving voice channel"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		}
+	}
+}
+
+// decides how to handle the closed connection. Reconnects are limited to voiceReconnectLimit
+// per voiceReconnectWindow, connections which keep closing are given up.
+func (v *VoiceRecovery) action(event lavalink.WebSocketClosedEvent) voiceCloseAction {
+	// players are disconnected on purpose when shutting down
+	if v.musicBot.closing() {
+		return voiceCloseIgnore
+	}
+
+	action := voiceCloseActionFor(event)
+	if action != voiceCloseResume && action != voiceCloseRejoin {
+		return action
+	}
+
+	if _, ok := v.reconnects.allow(event.GuildID(), 0, voiceReconnectLimit, voiceReconnectWindow); !ok {
+		logger.Error("voice connection keeps closing, giving up", slog.String("guild.id", event.GuildID().String()), slog.Int("code", event.Code))
+		return voiceCloseFatal
+	}
+	return action
+}
+
+// sends lavalink the voice state and last voice server of the guild again, so it reconnects, and resumes the track
+func (v *VoiceRecovery) resume(player disgolink.Player) {
+	guildID := player.GuildID()
+	voiceState, ok := v.musicBot.Client.Caches().VoiceState(guildID, v.musicBot.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		logger.Info("bot isn't in a voice channel anymore, not resuming", slog.String("guild.id", guildID.String()))
+		return
+	}
+
+	server, ok := v.musicBot.Nodes.voiceServer(guildID)
+	if !ok {
+		// nothing to reissue, get a new voice server from discord instead
+		v.rejoin(player)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	position := player.Position()
+	// disgolink forgets the voice session of the player once its connection closed
+	player.OnVoiceStateUpdate(ctx, voiceState.ChannelID, voiceState.SessionID)
+	player.OnVoiceServerUpdate(ctx, server.Token, server.Endpoint)
+	v.resumePlayer(ctx, player, position)
+}
+
+// joins the voice channel of the bot again, the track is resumed once discord sent the new voice server
+func (v *VoiceRecovery) rejoin(player disgolink.Player) {
+	guildID := player.GuildID()
+	voiceState, ok := v.musicBot.Client.Caches().VoiceState(guildID, v.musicBot.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		logger.Info("bot isn't in a voice channel anymore, not rejoining", slog.String("guild.id", guildID.String()))
+		return
+	}
+
+	v.mu.Lock()
+	v.resumes[guildID] = player.Position()
+	v.mu.Unlock()
+
+	if err := v.musicBot.Client.UpdateVoiceState(context.TODO(), guildID, voiceState.ChannelID, false, false); err != nil {
+		msg := "error while rejoining voice channel"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+	}
+}
+
+// resumes the player of a rejoined guild, called when discord sent the new voice server
+func (v *VoiceRecovery) OnVoiceServer(guildID snowflake.ID) {
+	v.mu.Lock()
+	position, ok := v.resumes[guildID]
+	delete(v.resumes, guildID)
+	v.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	player := v.musicBot.Lavalink.ExistingPlayer(guildID)
+	if player == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	v.resumePlayer(ctx, player, position)
+}
+
+// continues the current track at the position the connection was closed at
+func (v *VoiceRecovery) resumePlayer(ctx context.Context, player disgolink.Player, position lavalink.Duration) {
+	track := player.Track()
+	if track == nil || track.Info.IsStream {
+		return
+	}
+
+	if err := player.Update(ctx, lavalink.WithPosition(position)); err != nil {
+		msg := "error while resuming player"
+		logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", player.GuildID().String()))
+		return
+	}
+	logger.Info("resumed player after voice reconnect", slog.String("guild.id", player.GuildID().String()), slog.String("position", formatPosition(position)))
+}
+
+// cleans up the guild if the bot really left the voice channel, nothing is needed if it was only moved
+func (v *VoiceRecovery) checkDisconnected(guildID snowflake.ID) {
+	voiceState, ok := v.musicBot.Client.Caches().VoiceState(guildID, v.musicBot.Client.ApplicationID())
+	if ok && voiceState.ChannelID != nil {
+		logger.Info("bot was moved to another voice channel", slog.String("guild.id", guildID.String()), slog.String("channel.id", voiceState.ChannelID.String()))
+		return
+	}
+
+	logger.Info("bot was disconnected from voice, cleaning up", slog.String("guild.id", guildID.String()))
+	if player := v.musicBot.Lavalink.ExistingPlayer(guildID); player != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := player.Destroy(ctx); err != nil {
+			msg := "error while destroying player"
+			logger.Error(msg, tint.Err(eris.Wrap(err, msg)), slog.String("guild.id", guildID.String()))
+		}
+		v.musicBot.Lavalink.RemovePlayer(guildID)
+	}
+	v.musicBot.cleanupGuild(guildID)
+}
+
+// forgets the pending resume of the guild
+func (v *VoiceRecovery) Reset(guildID snowflake.ID) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.resumes, guildID)
+}
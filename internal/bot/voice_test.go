@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// records the voice updates disgolink would send to lavalink
+type fakeVoicePlayer struct {
+	disgolink.Player
+	guildID  snowflake.ID
+	position lavalink.Duration
+	calls    []string
+}
+
+func (p *fakeVoicePlayer) GuildID() snowflake.ID                                     { return p.guildID }
+func (p *fakeVoicePlayer) Position() lavalink.Duration                               { return p.position }
+func (p *fakeVoicePlayer) Track() *lavalink.Track                                    { return nil }
+func (p *fakeVoicePlayer) ChannelID() *snowflake.ID                                  { return nil }
+func (p *fakeVoicePlayer) Node() disgolink.Node                                      { return nil }
+func (p *fakeVoicePlayer) Update(context.Context, ...lavalink.PlayerUpdateOpt) error { return nil }
+
+func (p *fakeVoicePlayer) OnVoiceStateUpdate(_ context.Context, channelID *snowflake.ID, sessionID string) {
+	p.calls = append(p.calls, fmt.Sprintf("state %v %s", channelID != nil, sessionID))
+}
+
+func (p *fakeVoicePlayer) OnVoiceServerUpdate(_ context.Context, token string, endpoint string) {
+	p.calls = append(p.calls, fmt.Sprintf("server %s %s", token, endpoint))
+}
+
+func TestVoiceCloseActionFor(t *testing.T) {
+	tests := []struct {
+		code     int
+		byRemote bool
+		want     voiceCloseAction
+	}{
+		{1000, false, voiceCloseIgnore},
+		{1000, true, voiceCloseResume},
+		{1001, false, voiceCloseResume},
+		{1001, true, voiceCloseResume},
+		{1006, false, voiceCloseResume},
+		{1006, true, voiceCloseResume},
+		{4000, true, voiceCloseResume},
+		{4015, true, voiceCloseResume},
+		{4006, true, voiceCloseRejoin},
+		{4009, true, voiceCloseRejoin},
+		{4014, true, voiceCloseDisconnected},
+		{4014, false, voiceCloseDisconnected},
+		{4022, true, voiceCloseDisconnected},
+		{4001, true, voiceCloseFatal},
+		{4002, true, voiceCloseFatal},
+		{4003, true, voiceCloseFatal},
+		{4004, true, voiceCloseFatal},
+		{4005, true, voiceCloseFatal},
+		{4011, true, voiceCloseFatal},
+		{4012, true, voiceCloseFatal},
+		{4016, true, voiceCloseFatal},
+		{4020, true, voiceCloseFatal},
+		{4021, true, voiceCloseFatal},
+		{4999, false, voiceCloseFatal},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d/remote=%v", tt.code, tt.byRemote), func(t *testing.T) {
+			event := lavalink.WebSocketClosedEvent{Code: tt.code, ByRemote: tt.byRemote}
+			if got := voiceCloseActionFor(event); got != tt.want {
+				t.Errorf("voiceCloseActionFor(%d, %v) = %s, want %s", tt.code, tt.byRemote, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoiceRecoveryGivesUp(t *testing.T) {
+	b := newTestBot(t)
+	guildID := snowflake.ID(1)
+
+	for _, code := range []int{4006, 1006, 4015} {
+		event := lavalink.WebSocketClosedEvent{Code: code, ByRemote: true, GuildID_: guildID}
+		if got := b.Voice.action(event); got == voiceCloseFatal {
+			t.Fatalf("code %d gave up before %d reconnects", code, voiceReconnectLimit)
+		}
+	}
+
+	event := lavalink.WebSocketClosedEvent{Code: 1006, ByRemote: true, GuildID_: guildID}
+	if got := b.Voice.action(event); got != voiceCloseFatal {
+		t.Errorf("reconnect %d = %s, want %s", voiceReconnectLimit+1, got, voiceCloseFatal)
+	}
+
+	// other guilds have their own limit
+	other := lavalink.WebSocketClosedEvent{Code: 1006, ByRemote: true, GuildID_: 2}
+	if got := b.Voice.action(other); got != voiceCloseResume {
+		t.Errorf("other guild = %s, want %s", got, voiceCloseResume)
+	}
+
+	// disconnects aren't reconnects and are never given up
+	disconnected := lavalink.WebSocketClosedEvent{Code: 4014, ByRemote: true, GuildID_: guildID}
+	if got := b.Voice.action(disconnected); got != voiceCloseDisconnected {
+		t.Errorf("disconnect after limit = %s, want %s", got, voiceCloseDisconnected)
+	}
+}
+
+func TestVoiceRecoveryIgnoresWhenClosing(t *testing.T) {
+	b := newTestBot(t)
+	close(b.done)
+
+	event := lavalink.WebSocketClosedEvent{Code: 4006, ByRemote: true, GuildID_: 1}
+	if got := b.Voice.action(event); got != voiceCloseIgnore {
+		t.Errorf("action while closing = %s, want %s", got, voiceCloseIgnore)
+	}
+}
+
+func TestVoiceRecoveryOnClosed(t *testing.T) {
+	guildID := snowflake.ID(1)
+	channelID := snowflake.ID(2)
+
+	tests := []struct {
+		name string
+		code int
+		// whether the bot is in a voice channel and has a known voice server
+		inChannel   bool
+		voiceServer bool
+		wantCalls   []string
+		wantResume  bool
+	}{
+		{
+			name:        "resume sends voice state before server",
+			code:        1006,
+			inChannel:   true,
+			voiceServer: true,
+			wantCalls:   []string{"state true session", "server token endpoint"},
+		},
+		{
+			name:       "resume without voice server rejoins",
+			code:       4015,
+			inChannel:  true,
+			wantResume: true,
+		},
+		{
+			name:        "resume outside of a channel does nothing",
+			code:        1006,
+			voiceServer: true,
+		},
+		{
+			name:        "rejoin waits for the new voice server",
+			code:        4006,
+			inChannel:   true,
+			voiceServer: true,
+			wantResume:  true,
+		},
+		{
+			name:        "closed by us is ignored",
+			code:        1000,
+			inChannel:   true,
+			voiceServer: true,
+		},
+		{
+			name:        "fatal doesn't reconnect",
+			code:        4004,
+			inChannel:   true,
+			voiceServer: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t)
+			if tt.inChannel {
+				b.Client.Caches().AddVoiceState(discord.VoiceState{
+					GuildID:   guildID,
+					ChannelID: &channelID,
+					UserID:    b.Client.ApplicationID(),
+					SessionID: "session",
+				})
+			}
+			if tt.voiceServer {
+				b.Nodes.setVoiceServer(guildID, "token", "endpoint")
+			}
+
+			player := &fakeVoicePlayer{guildID: guildID, position: lavalink.Second * 42}
+			b.Voice.OnClosed(player, lavalink.WebSocketClosedEvent{Code: tt.code, ByRemote: tt.code != 1000, GuildID_: guildID})
+
+			if fmt.Sprint(player.calls) != fmt.Sprint(tt.wantCalls) {
+				t.Errorf("voice updates = %v, want %v", player.calls, tt.wantCalls)
+			}
+
+			b.Voice.mu.Lock()
+			position, ok := b.Voice.resumes[guildID]
+			b.Voice.mu.Unlock()
+			if ok != tt.wantResume {
+				t.Fatalf("pending resume = %v, want %v", ok, tt.wantResume)
+			}
+			if ok && position != player.position {
+				t.Errorf("resume position = %s, want %s", position, player.position)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgolink/v3/disgolink"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+const (
+	// anyone allowed to skip skips immediately
+	skipModeDirect = "direct"
+	// listeners vote, DJs and requesters still skip immediately
+	skipModeVote = "vote"
+)
+
+// VoteSkips holds the skip votes for the current track of every guild
+type VoteSkips struct {
+	mu    sync.Mutex
+	votes map[snowflake.ID]map[snowflake.ID]struct{}
+}
+
+func NewVoteSkips() *VoteSkips {
+	return &VoteSkips{
+		votes: make(map[snowflake.ID]map[snowflake.ID]struct{}),
+	}
+}
+
+// outcome of a skip vote
+type voteResult struct {
+	// votes of the current listeners and how many are needed to skip
+	votes  int
+	needed int
+	// the user already voted for this track
+	duplicate bool
+	// this vote reached the needed votes, the caller has to skip the track
+	passed bool
+}
+
+// adds the users vote and counts the votes of the listeners, votes of users who left don't count.
+// once enough listeners voted the votes are reset, all under one lock so only a single vote passes.
+func (v *VoteSkips) Vote(guildID snowflake.ID, userID snowflake.ID, listeners []snowflake.ID) voteResult {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	result := voteResult{needed: votesNeeded(len(listeners))}
+
+	votes, ok := v.votes[guildID]
+	if !ok {
+		votes = make(map[snowflake.ID]struct{})
+		v.votes[guildID] = votes
+	}
+	if _, ok = votes[userID]; ok {
+		result.duplicate = true
+	}
+	votes[userID] = struct{}{}
+
+	for _, listenerID := range listeners {
+		if _, ok := votes[listenerID]; ok {
+			result.votes++
+		}
+	}
+
+	if !result.duplicate && result.votes >= result.needed {
+		result.passed = true
+		delete(v.votes, guildID)
+	}
+	return result
+}
+
+// removes all votes of the guild, called when a new track starts
+func (v *VoteSkips) Reset(guildID snowflake.ID) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.votes, guildID)
+}
+
+func voteSkipEnabled() bool {
+	return k.String("skip.mode") == skipModeVote
+}
+
+// returns how many of the listeners have to vote to skip
+func votesNeeded(listeners int) int {
+	return max(int(math.Ceil(k.Float64("skip.vote.ratio")*float64(listeners))), 1)
+}
+
+// plays the next track of the queue, or stops the player if the queue is empty
+func (b *MusicBot) skipCurrent(ctx context.Context, player disgolink.Player) error {
+	_, ok, err := b.Queues.Get(player.GuildID()).NextAndPlay(func(track lavalink.Track) error {
+		return player.Update(ctx, lavalink.WithTrack(track))
+	})
+	if !ok {
+		if b.Autoplay.SkipToRelated(player) {
+			return nil
+		}
+		return player.Update(ctx, lavalink.WithNullTrack())
+	}
+	return err
+}
+
+// adds the users skip vote and skips the current track once enough listeners voted.
+// returns the message to show to the user.
+func (b *MusicBot) voteSkip(guildID snowflake.ID, userID snowflake.ID) (string, error) {
+	player := b.Lavalink.ExistingPlayer(guildID)
+	if player == nil || player.Track() == nil {
+		return "Nothing is playing", nil
+	}
+	voiceState, ok := b.Client.Caches().VoiceState(guildID, b.Client.ApplicationID())
+	if !ok || voiceState.ChannelID == nil {
+		return "The bot is not in a voice channel", nil
+	}
+
+	result := b.VoteSkips.Vote(guildID, userID, b.listeners(guildID, *voiceState.ChannelID))
+	if result.duplicate {
+		return "You already voted to skip this track", nil
+	}
+	if !result.passed {
+		return fmt.Sprintf("Voted to skip, `%d/%d` votes", result.votes, result.needed), nil
+	}
+
+	if err := b.skipCurrent(context.TODO(), player); err != nil {
+		return fmt.Sprintf("Error while skipping track: `%s`", err), err
+	}
+	return fmt.Sprintf("Vote passed with `%d/%d` votes, skipped track", result.votes, result.needed), nil
+}
+
+func (h CmdHandler) panelVoteSkip(event *handler.ComponentEvent) error {
+	msg, _ := h.musicBot.voteSkip(*event.GuildID(), event.User().ID)
+	return event.CreateMessage(discord.MessageCreate{
+		Content: msg,
+		Flags:   discord.MessageFlagEphemeral,
+	})
+}
@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgolink/v3/lavalink"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+func TestVoteSkipsVote(t *testing.T) {
+	voteSkips := NewVoteSkips()
+	guildID := snowflake.ID(1)
+	listeners := []snowflake.ID{10, 11, 12, 13}
+
+	// half of four listeners have to vote with the default ratio
+	if result := voteSkips.Vote(guildID, 10, listeners); result.passed || result.votes != 1 || result.needed != 2 {
+		t.Fatalf("first vote = %+v, want 1/2 votes", result)
+	}
+	if result := voteSkips.Vote(guildID, 10, listeners); !result.duplicate || result.passed {
+		t.Fatalf("second vote of the same user = %+v, want duplicate", result)
+	}
+	// users who aren't listening don't count
+	if result := voteSkips.Vote(guildID, 99, listeners); result.passed || result.votes != 1 {
+		t.Fatalf("vote of a non listener = %+v, want 1/2 votes", result)
+	}
+	if result := voteSkips.Vote(guildID, 11, listeners); !result.passed || result.votes != 2 {
+		t.Fatalf("deciding vote = %+v, want passed with 2 votes", result)
+	}
+	// the votes are reset once a vote passed
+	if result := voteSkips.Vote(guildID, 12, listeners); result.passed || result.votes != 1 {
+		t.Fatalf("vote after passing = %+v, want 1/2 votes", result)
+	}
+}
+
+func TestVoteSkipsConcurrentVotesPassOnce(t *testing.T) {
+	voteSkips := NewVoteSkips()
+	guildID := snowflake.ID(1)
+
+	// half of the listeners vote at once, exactly enough to skip
+	listeners := make([]snowflake.ID, testWorkers*2)
+	for i := range listeners {
+		listeners[i] = snowflake.ID(i + 1)
+	}
+
+	var (
+		passed atomic.Int64
+		wg     sync.WaitGroup
+	)
+	for _, userID := range listeners[:testWorkers] {
+		wg.Add(1)
+		go func(userID snowflake.ID) {
+			defer wg.Done()
+			if voteSkips.Vote(guildID, userID, listeners).passed {
+				passed.Add(1)
+			}
+		}(userID)
+	}
+	wg.Wait()
+
+	if passed.Load() != 1 {
+		t.Errorf("%d votes passed, want 1", passed.Load())
+	}
+}
+
+func TestPermissionsCanSkip(t *testing.T) {
+	b := newTestBot(t)
+	guildID := snowflake.ID(1)
+
+	requester := discord.ResolvedMember{Member: discord.Member{User: discord.User{ID: 10}}}
+	listener := discord.ResolvedMember{Member: discord.Member{User: discord.User{ID: 11}}}
+	manager := discord.ResolvedMember{Member: discord.Member{User: discord.User{ID: 12}}, Permissions: discord.PermissionManageGuild}
+	track := withRequest([]lavalink.Track{testTrack(0)}, TrackRequest{UserID: requester.User.ID})[0]
+
+	setSkipMode := func(mode string) {
+		t.Helper()
+		previous := k.String("skip.mode")
+		if err := k.Set("skip.mode", mode); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = k.Set("skip.mode", previous) })
+	}
+
+	setSkipMode(skipModeDirect)
+	if !b.Permissions.CanSkip(guildID, listener, track) {
+		t.Error("direct mode without DJ role: listener can't skip")
+	}
+	if !b.Permissions.CanChangeTrack(guildID, listener) {
+		t.Error("direct mode without DJ role: listener can't change the track")
+	}
+
+	setSkipMode(skipModeVote)
+	if b.Permissions.CanSkip(guildID, listener, track) {
+		t.Error("vote mode without DJ role: listener skips without voting")
+	}
+	// commands like /stop and /skipto skip the track as well
+	for _, path := range []string{"/stop", "/skipto", "/jump", "/previous", "/player/stop"} {
+		if pathPermission(path) != permissionTrackDJ {
+			t.Errorf("%s doesn't need the track changing permission", path)
+		}
+	}
+	if b.Permissions.CanChangeTrack(guildID, listener) {
+		t.Error("vote mode without DJ role: listener changes the track without voting")
+	}
+	if !b.Permissions.CanChangeTrack(guildID, manager) {
+		t.Error("vote mode: manager can't change the track")
+	}
+	if !b.Permissions.CanSkip(guildID, requester, track) {
+		t.Error("vote mode: requester can't skip their own track")
+	}
+	if !b.Permissions.CanSkip(guildID, manager, track) {
+		t.Error("vote mode: manager can't skip")
+	}
+
+	if err := b.Permissions.SetDJRole(guildID, 50); err != nil {
+		t.Fatal(err)
+	}
+	dj := discord.ResolvedMember{Member: discord.Member{User: discord.User{ID: 13}, RoleIDs: []snowflake.ID{50}}}
+	if !b.Permissions.CanSkip(guildID, dj, track) {
+		t.Error("vote mode: DJ can't skip")
+	}
+	if b.Permissions.CanSkip(guildID, listener, track) {
+		t.Error("vote mode with DJ role: listener skips without voting")
+	}
+}